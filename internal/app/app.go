@@ -0,0 +1,250 @@
+// Package app assembles one tracker instance: its cache, geocoder,
+// templates, handlers and routes, all built from a config.Config. Tests
+// build several Apps in one process without them interfering.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"groupie-tracker/internal/cache"
+	"groupie-tracker/internal/config"
+	"groupie-tracker/internal/geocoding"
+	"groupie-tracker/internal/handlers"
+	"groupie-tracker/internal/logging"
+	"groupie-tracker/internal/metrics"
+	"groupie-tracker/internal/models"
+)
+
+// App is a tracker instance. Build it with New, load its data with Start
+// and serve it as an http.Handler.
+type App struct {
+	config   config.Config
+	logger   *slog.Logger
+	cache    *cache.Cache
+	geocoder *geocoding.Resolver
+	handlers *handlers.Handlers
+	metrics  *metrics.Registry
+	http     *metrics.HTTP
+
+	indexTpl         *template.Template
+	artistDetailsTpl *template.Template
+	mux              *http.ServeMux
+	handler          http.Handler
+}
+
+// New builds an App from cfg, logging to logger. Templates and static files
+// are read relative to the working directory. Nothing is fetched from the
+// upstream until Start.
+func New(cfg config.Config, logger *slog.Logger) (*App, error) {
+	a := &App{config: cfg, logger: logger, metrics: metrics.NewRegistry(), mux: http.NewServeMux()}
+	a.http = metrics.NewHTTP(a.metrics)
+
+	// Every outbound request shares one client, bounded by the upstream
+	// timeout
+	client := newHTTPClient(cfg)
+
+	// Select the geocoder
+	var provider geocoding.Geocoder
+	switch cfg.Geocoder {
+	case "mapbox":
+		mapbox := geocoding.NewMapbox(cfg.MapboxAPI, cfg.MapboxToken)
+		mapbox.Client = client
+		provider = mapbox
+	case "gazetteer":
+		gazetteer, err := geocoding.LoadGazetteer(cfg.Gazetteer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load gazetteer: %v", err)
+		}
+		logger.Info("Using offline gazetteer", "path", cfg.Gazetteer, "places", gazetteer.Len())
+		provider = gazetteer
+	default:
+		return nil, fmt.Errorf("unknown geocoder %q", cfg.Geocoder)
+	}
+	resolver, err := geocoding.New(provider, cfg.GeocodeCache, cfg.GeocodeWorkers)
+	if err != nil {
+		logger.Warn("Starting with an empty geocoding cache", "error", err)
+	}
+	resolver.SetLogger(logger)
+	resolver.SetMetrics(a.metrics)
+	a.geocoder = resolver
+
+	// Select the upstream data source
+	var source cache.DataSource
+	switch cfg.Source {
+	case "api":
+		httpSource := cache.NewHTTPSource(cfg.APIBase)
+		httpSource.Client = client
+		source = httpSource
+		logger.Info("Using upstream API", "url", cfg.APIBase, "timeout", cfg.UpstreamTimeout)
+	case "file":
+		source = cache.NewFileSource(cfg.DataDir)
+		logger.Info("Using data files", "dir", cfg.DataDir)
+	default:
+		return nil, fmt.Errorf("unknown data source %q", cfg.Source)
+	}
+	a.cache = cache.New(cfg.CacheDuration, source)
+	a.cache.SetSnapshot(cfg.Snapshot, cfg.SnapshotStale)
+	a.cache.SetLogger(logger)
+	a.cache.SetMetrics(a.metrics)
+
+	a.handlers = handlers.New(a.cache, a.geocoder, logger)
+	if !cfg.Now.IsZero() {
+		a.handlers.SetNow(cfg.Now)
+		logger.Info("Classifying concerts against a fixed date", "now", cfg.Now.Format(time.DateOnly))
+	}
+	a.handlers.SetFuzziness(cfg.Fuzzy)
+	a.handlers.SetMaxStaleness(cfg.MaxStaleness)
+	if cfg.BrowserMapboxToken() == "" {
+		logger.Warn("No mapbox-public-token set, maps in the browser are off")
+	}
+	a.handlers.SetClientConfig(models.ClientConfig{MapboxToken: cfg.BrowserMapboxToken()})
+
+	if a.indexTpl, err = template.ParseFiles("templates/index.html"); err != nil {
+		return nil, fmt.Errorf("failed to parse index template: %v", err)
+	}
+	if a.artistDetailsTpl, err = template.ParseFiles("templates/artist-details.html"); err != nil {
+		return nil, fmt.Errorf("failed to parse artist details template: %v", err)
+	}
+
+	a.routes()
+	a.handler = logging.Middleware(logger, a.mux)
+	return a, nil
+}
+
+// newHTTPClient returns the client for requests to the upstream API and the
+// geocoding provider. The upstream timeout bounds each request from
+// connecting to reading the body; the transport also bounds connecting and
+// the TLS handshake on their own so a dead host fails fast, and keeps a
+// connection open for every geocoding worker.
+func newHTTPClient(cfg config.Config) *http.Client {
+	timeout := cfg.UpstreamTimeout
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: min(timeout, 5*time.Second), KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = min(timeout, 5*time.Second)
+	transport.ResponseHeaderTimeout = timeout
+	transport.MaxIdleConnsPerHost = max(cfg.GeocodeWorkers, http.DefaultMaxIdleConnsPerHost)
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// routes registers every page, API endpoint, the metrics and the static
+// files on the App's own mux.
+func (a *App) routes() {
+	a.handle("/", a.handlers.HandleIndex(a.indexTpl))
+	a.handle("/artist/", a.handlers.HandleArtistDetails(a.artistDetailsTpl))
+	a.handle("/api/search", http.HandlerFunc(a.handlers.HandleSearch))
+	a.handle("/api/artist/", http.HandlerFunc(a.handlers.HandleArtist))
+	a.handle("/api/suggestions", http.HandlerFunc(a.handlers.HandleSuggestions))
+	a.handle("/api/config", http.HandlerFunc(a.handlers.HandleConfig))
+	a.handle("/api/status", http.HandlerFunc(a.handlers.HandleStatus))
+	a.handle("/healthz", http.HandlerFunc(a.handlers.HandleHealth))
+	a.handle("/readyz", http.HandlerFunc(a.handlers.HandleReady))
+	a.handle("/metrics", a.metrics.Handler())
+
+	fs := http.FileServer(http.Dir("static"))
+	a.handle("/static/", http.StripPrefix("/static/", fs))
+}
+
+// handle registers h for pattern, counting and timing its requests under
+// that pattern.
+func (a *App) handle(pattern string, h http.Handler) {
+	a.mux.Handle(pattern, a.http.Wrap(pattern, h))
+}
+
+// Start loads the initial data, falling back to the snapshot when the
+// upstream cannot be reached, and starts renewing it in the background.
+func (a *App) Start() error {
+	if err := a.cache.RefreshCache(context.Background()); err != nil {
+		if a.config.Snapshot == "" {
+			return fmt.Errorf("failed to fetch initial data: %v", err)
+		}
+		a.logger.Warn("Failed to fetch initial data, loading snapshot", "path", a.config.Snapshot, "error", err)
+		if err := a.cache.LoadSnapshot(); err != nil {
+			return fmt.Errorf("failed to load snapshot: %v", err)
+		}
+		a.logger.Info("Loaded snapshot", "saved_at", a.cache.LastRefresh().Format(time.RFC3339))
+	} else {
+		a.logger.Info("Initial data fetched successfully")
+	}
+
+	a.cache.StartRefresher()
+	a.logger.Info("Background cache refresher started")
+	return nil
+}
+
+// ServeHTTP serves the App's routes, giving each request an ID and logging
+// it.
+func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.handler.ServeHTTP(w, r)
+}
+
+// Run listens on the configured address and serves until ctx is done, then
+// shuts down gracefully. See Serve.
+func (a *App) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", a.config.Addr)
+	if err != nil {
+		return err
+	}
+	return a.Serve(ctx, ln)
+}
+
+// Serve serves the App on ln until ctx is done. It then stops accepting
+// connections and waits up to the shutdown timeout for requests in flight
+// before closing the connections still open. The App itself stays usable;
+// Close it afterwards.
+func (a *App) Serve(ctx context.Context, ln net.Listener) error {
+	srv := a.server()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	a.logger.Info("Shutting down, waiting for requests in flight", "timeout", a.config.ShutdownTimeout)
+	drainCtx, cancel := context.WithTimeout(context.Background(), a.config.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(drainCtx); err != nil {
+		a.logger.Warn("Requests still in flight after the shutdown timeout, closing their connections", "timeout", a.config.ShutdownTimeout)
+		srv.Close()
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// server returns an http.Server for the App with the configured timeouts,
+// so slow or idle clients cannot hold connections open indefinitely.
+func (a *App) server() *http.Server {
+	return &http.Server{
+		Addr:              a.config.Addr,
+		Handler:           a,
+		ReadHeaderTimeout: a.config.ReadTimeout,
+		ReadTimeout:       a.config.ReadTimeout,
+		WriteTimeout:      a.config.WriteTimeout,
+		IdleTimeout:       a.config.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(a.logger.Handler(), slog.LevelWarn),
+	}
+}
+
+// Close stops the background refresher and the geocoder, waiting for the
+// refresh and lookups in flight, and saves the geocoding cache.
+func (a *App) Close() {
+	a.cache.Close()
+	if err := a.geocoder.Close(); err != nil {
+		a.logger.Error("Failed to save geocoding cache", "error", err)
+	}
+}
@@ -0,0 +1,394 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"groupie-tracker/internal/config"
+	"groupie-tracker/internal/logging"
+	"groupie-tracker/internal/models"
+)
+
+// fixturesDir holds the upstream fixtures, resolved before TestMain changes
+// directory.
+var fixturesDir string
+
+// TestMain runs from the repository root so the templates, static files and
+// bundled gazetteer resolve.
+func TestMain(m *testing.M) {
+	var err error
+	fixturesDir, err = filepath.Abs(filepath.Join("..", "handlers", "testdata"))
+	if err != nil {
+		panic(err)
+	}
+	if err := os.Chdir(filepath.Join("..", "..")); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeUpstream serves the fixtures the way the Groupie Trackers API does,
+// keeping only the first artists artists.
+func fakeUpstream(t *testing.T, artists int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := filepath.Base(r.URL.Path)
+		data, err := os.ReadFile(filepath.Join(fixturesDir, name+".json"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if name == "artists" {
+			var all []models.Artist
+			if err := json.Unmarshal(data, &all); err != nil {
+				t.Error(err)
+			}
+			json.NewEncoder(w).Encode(all[:artists])
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newApp builds and starts an App over upstream with offline geocoding and
+// nothing written to disk.
+func newApp(t *testing.T, upstream string) *App {
+	t.Helper()
+	return newAppWith(t, upstream, func(*config.Config) {})
+}
+
+// newAppWith is newApp with settings adjusted by configure.
+func newAppWith(t *testing.T, upstream string, configure func(*config.Config)) *App {
+	t.Helper()
+	cfg := config.Default()
+	cfg.APIBase = upstream + "/api"
+	cfg.Geocoder = "gazetteer"
+	cfg.Snapshot = ""
+	cfg.GeocodeCache = ""
+	configure(&cfg)
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := New(cfg, logging.Discard())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(a.Close)
+	if err := a.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	return a
+}
+
+// TestAppsSideBySide tests that apps over different upstreams serve their
+// own data
+func TestAppsSideBySide(t *testing.T) {
+	apps := []struct {
+		app      *App
+		expected int
+	}{
+		{newApp(t, fakeUpstream(t, 4).URL), 4},
+		{newApp(t, fakeUpstream(t, 1).URL), 1},
+	}
+
+	for _, tt := range apps {
+		w := httptest.NewRecorder()
+		tt.app.ServeHTTP(w, httptest.NewRequest("GET", "/api/search", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET /api/search status code = %v, want %v", w.Code, http.StatusOK)
+		}
+		var result models.SearchResult
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		if result.Total != tt.expected {
+			t.Errorf("GET /api/search total = %d, want %d", result.Total, tt.expected)
+		}
+	}
+}
+
+// TestRoutes tests that pages, API endpoints and static files are served
+func TestRoutes(t *testing.T) {
+	a := newApp(t, fakeUpstream(t, 4).URL)
+
+	tests := []struct {
+		path           string
+		expectedStatus int
+	}{
+		{"/", http.StatusOK},
+		{"/artist/1", http.StatusOK},
+		{"/api/artist/1", http.StatusOK},
+		{"/api/search?q=queen", http.StatusOK},
+		{"/api/suggestions?q=qu", http.StatusOK},
+		{"/api/config", http.StatusOK},
+		{"/api/status", http.StatusOK},
+		{"/healthz", http.StatusOK},
+		{"/readyz", http.StatusOK},
+		{"/metrics", http.StatusOK},
+		{"/static/js/index.js", http.StatusOK},
+		{"/static/js/api.js", http.StatusOK},
+		{"/nowhere", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			a.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.expectedStatus {
+				t.Errorf("GET %s status code = %v, want %v", tt.path, w.Code, tt.expectedStatus)
+			}
+		})
+	}
+}
+
+// TestMetrics tests that requests are counted under the route they matched
+func TestMetrics(t *testing.T) {
+	a := newApp(t, fakeUpstream(t, 4).URL)
+	for _, path := range []string{"/api/artist/1", "/api/artist/2", "/nowhere"} {
+		a.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, expected := range []string{
+		`groupie_http_requests_total{route="/api/artist/",method="GET",code="200"} 2`,
+		`groupie_http_requests_total{route="/",method="GET",code="404"} 1`,
+		`groupie_upstream_fetch_duration_seconds_count{dataset="artists"} 1`,
+		"groupie_cache_artists 4",
+		"groupie_geocode_cache_entries",
+	} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("GET /metrics = %s\nwant it to contain %q", w.Body.String(), expected)
+		}
+	}
+}
+
+// TestRequestLogging tests that the cache and geocoder records written
+// while serving a request carry its ID, as do API errors
+func TestRequestLogging(t *testing.T) {
+	cfg := config.Default()
+	cfg.APIBase = fakeUpstream(t, 4).URL + "/api"
+	cfg.Geocoder = "gazetteer"
+	cfg.Snapshot = ""
+	cfg.GeocodeCache = ""
+
+	var buf bytes.Buffer
+	a, err := New(cfg, logging.New(&buf))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer a.Close()
+	buf.Reset()
+
+	// The first request finds the cache empty and fetches the data itself
+	req := httptest.NewRequest("GET", "/api/artist/1", nil)
+	req.Header.Set("X-Request-ID", "trace-1")
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("X-Request-ID") != "trace-1" {
+		t.Fatalf("GET /api/artist/1 = %v with X-Request-ID %q, want 200 with trace-1", w.Code, w.Header().Get("X-Request-ID"))
+	}
+
+	traced := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record struct {
+			Msg       string `json:"msg"`
+			RequestID string `json:"request_id"`
+		}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", line, err)
+		}
+		if record.RequestID == "trace-1" {
+			traced[record.Msg] = true
+		}
+	}
+	for _, msg := range []string{"No data loaded yet, fetching from the upstream", "Cache refreshed", "Geocoded location", "Request served"} {
+		if !traced[msg] {
+			t.Errorf("no %q record with request_id trace-1 in\n%s", msg, buf.String())
+		}
+	}
+
+	w = httptest.NewRecorder()
+	a.ServeHTTP(w, httptest.NewRequest("GET", "/api/artist/999", nil))
+	var apiErr models.APIError
+	if err := json.NewDecoder(w.Body).Decode(&apiErr); err != nil {
+		t.Fatal(err)
+	}
+	if apiErr.RequestID == "" || apiErr.RequestID != w.Header().Get("X-Request-ID") {
+		t.Errorf("error request ID = %q, header %q, want the ID the request was logged with", apiErr.RequestID, w.Header().Get("X-Request-ID"))
+	}
+}
+
+// TestStartWithoutUpstream tests that an unreachable upstream without a
+// snapshot fails to start
+func TestStartWithoutUpstream(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	cfg := config.Default()
+	cfg.APIBase = srv.URL + "/api"
+	cfg.Geocoder = "gazetteer"
+	cfg.Snapshot = ""
+	cfg.GeocodeCache = ""
+
+	a, err := New(cfg, logging.Discard())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer a.Close()
+	if err := a.Start(); err == nil {
+		t.Error("Start() error = nil, want the failed fetch")
+	}
+}
+
+// hungServer accepts requests and never answers them, until the client
+// gives up.
+func hungServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestUpstreamTimeout tests that a hung upstream fails the fetch after the
+// upstream timeout
+func TestUpstreamTimeout(t *testing.T) {
+	cfg := config.Default()
+	cfg.APIBase = hungServer(t).URL + "/api"
+	cfg.Geocoder = "gazetteer"
+	cfg.Snapshot = ""
+	cfg.GeocodeCache = ""
+	cfg.UpstreamTimeout = 50 * time.Millisecond
+
+	a, err := New(cfg, logging.Discard())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer a.Close()
+
+	start := time.Now()
+	if err := a.Start(); err == nil {
+		t.Error("Start() error = nil, want the timed out fetch")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Start() took %s, want it bounded by the upstream timeout", elapsed)
+	}
+}
+
+// TestAbandonedArtistPage tests that an artist request whose client goes
+// away stops waiting on the geocoding provider
+func TestAbandonedArtistPage(t *testing.T) {
+	mapbox := hungServer(t)
+	a := newAppWith(t, fakeUpstream(t, 4).URL, func(cfg *config.Config) {
+		cfg.Geocoder = "mapbox"
+		cfg.MapboxAPI = mapbox.URL
+		cfg.MapboxToken = "token"
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	w := httptest.NewRecorder()
+	start := time.Now()
+	a.ServeHTTP(w, httptest.NewRequest("GET", "/api/artist/1", nil).WithContext(ctx))
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("abandoned request took %s, want it to stop with its client", elapsed)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("abandoned request body = %q, want nothing written", w.Body.String())
+	}
+	if stats := a.geocoder.Stats(); stats.Entries != 0 || stats.LastError != nil {
+		t.Errorf("geocoder stats = %+v, want nothing cached and no provider failure", stats)
+	}
+}
+
+// serveSlow serves a with an extra route that takes delay to answer, and
+// returns the base URL, a function that starts the shutdown and the result
+// of Serve.
+func serveSlow(t *testing.T, a *App, delay time.Duration) (string, context.CancelFunc, <-chan error) {
+	t.Helper()
+	a.mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.Write([]byte("done"))
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	served := make(chan error, 1)
+	go func() {
+		served <- a.Serve(ctx, ln)
+	}()
+	return "http://" + ln.Addr().String(), cancel, served
+}
+
+// TestServeDrains tests that shutdown lets requests in flight finish and
+// refuses new connections
+func TestServeDrains(t *testing.T) {
+	a := newApp(t, fakeUpstream(t, 4).URL)
+	base, shutdown, served := serveSlow(t, a, 200*time.Millisecond)
+
+	response := make(chan error, 1)
+	go func() {
+		resp, err := http.Get(base + "/slow")
+		if err == nil {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if string(body) != "done" {
+				err = io.ErrUnexpectedEOF
+			}
+		}
+		response <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	shutdown()
+
+	if err := <-response; err != nil {
+		t.Errorf("request in flight during shutdown error = %v, want it answered", err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Serve() error = %v, want a clean shutdown", err)
+	}
+	if _, err := http.Get(base + "/api/config"); err == nil {
+		t.Error("request after shutdown succeeded, want the connection refused")
+	}
+}
+
+// TestServeDrainDeadline tests that shutdown gives up on requests still in
+// flight after the shutdown timeout
+func TestServeDrainDeadline(t *testing.T) {
+	a := newAppWith(t, fakeUpstream(t, 4).URL, func(cfg *config.Config) {
+		cfg.ShutdownTimeout = 20 * time.Millisecond
+	})
+	base, shutdown, served := serveSlow(t, a, time.Second)
+
+	go http.Get(base + "/slow")
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	shutdown()
+
+	if err := <-served; err == nil {
+		t.Error("Serve() error = nil, want the missed drain deadline")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("shutdown took %s, want it bounded by the shutdown timeout", elapsed)
+	}
+}
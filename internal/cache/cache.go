@@ -1,97 +1,352 @@
 package cache
 
 import (
-	"encoding/json"
-	"fmt"
-	"net/http"
+	"context"
+	"log/slog"
 	"sync"
 	"time"
 
+	"groupie-tracker/internal/dates"
+	"groupie-tracker/internal/metrics"
 	"groupie-tracker/internal/models"
-	"groupie-tracker/internal/service"
+	"groupie-tracker/internal/search"
 )
 
-var (
-	cache    Cache
+// Cache holds the upstream datasets and the search index built from them,
+// renewing both from its DataSource once they are older than its duration.
+// A Cache shares no state with other Caches.
+type Cache struct {
 	duration time.Duration
-)
+	source   DataSource
+	logger   *slog.Logger
+	metrics  *cacheMetrics
+
+	snapshotPath       string
+	allowStaleSnapshot bool
 
-type Cache struct {
 	data      models.Datas
+	index     *search.Index
+	fetchedAt time.Time
 	expiresAt time.Time
 	mutex     sync.RWMutex
+
+	// lastAttempt and lastErr record the most recent refresh, successful
+	// or not, guarded by mutex.
+	lastAttempt time.Time
+	lastErr     error
+
+	// inflight is the refresh currently talking to the upstream, shared by
+	// every caller that asks for a refresh while it runs.
+	inflight  *refreshCall
+	refreshMu sync.Mutex
+
+	stopRefresher chan struct{}
+	refresherDone chan struct{}
+
+	// closing is cancelled by Close, abandoning any refresh in flight.
+	closing       context.Context
+	cancelClosing context.CancelFunc
+}
+
+type refreshCall struct {
+	done chan struct{}
+	err  error
+}
+
+// New returns an empty cache whose data is fetched from src and kept for
+// duration. A nil src falls back to the public Groupie Trackers API.
+// Snapshots stay disabled until SetSnapshot is called, messages go to the
+// standard logger until SetLogger is, and metrics go unread until
+// SetMetrics is.
+func New(duration time.Duration, src DataSource) *Cache {
+	if src == nil {
+		src = DefaultSource()
+	}
+	closing, cancelClosing := context.WithCancel(context.Background())
+	return &Cache{
+		duration:      duration,
+		source:        src,
+		logger:        slog.Default(),
+		metrics:       newCacheMetrics(metrics.NewRegistry()),
+		closing:       closing,
+		cancelClosing: cancelClosing,
+	}
+}
+
+// SetLogger sets where data issues and failed background refreshes are
+// reported.
+func (c *Cache) SetLogger(logger *slog.Logger) {
+	c.logger = logger
+}
+
+// RefreshCache fetches a fresh copy of every dataset. Concurrent callers
+// share a single upstream fetch and all receive its result. On failure the
+// previously cached data is kept. A caller whose ctx is done stops waiting
+// with ctx's error, but the fetch carries on for the others until it
+// finishes, times out or the cache is closed. Log records about the
+// refresh carry the request ID in ctx of the caller that started it.
+func (c *Cache) RefreshCache(ctx context.Context) error {
+	call, leader := c.beginRefresh()
+	if leader {
+		go c.runRefresh(ctx, call)
+	}
+	select {
+	case <-call.done:
+		return call.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-func Init(cacheDuration time.Duration) {
-	cache = Cache{}
-	duration = cacheDuration
+// beginRefresh returns the in-flight refresh, registering a new one if none
+// is running. leader reports whether the caller must run the new refresh.
+func (c *Cache) beginRefresh() (call *refreshCall, leader bool) {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	if c.inflight != nil {
+		return c.inflight, false
+	}
+	c.inflight = &refreshCall{done: make(chan struct{})}
+	return c.inflight, true
+}
+
+// runRefresh runs call until it finishes or the cache is closed. It keeps
+// ctx's values, such as the request ID, but not its cancellation, since
+// other callers may be waiting on the same refresh.
+func (c *Cache) runRefresh(ctx context.Context, call *refreshCall) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	defer context.AfterFunc(c.closing, cancel)()
+
+	start := time.Now()
+	call.err = c.refresh(ctx)
+	if call.err == nil {
+		c.logger.InfoContext(ctx, "Cache refreshed", "duration", time.Since(start))
+	}
+	c.metrics.observeRefresh(call.err)
+
+	c.mutex.Lock()
+	c.lastAttempt, c.lastErr = time.Now(), call.err
+	if call.err != nil && !c.fetchedAt.IsZero() {
+		// Keep serving the stale data until the retry delay has passed, so
+		// requests do not send back-to-back fetches to a failing upstream.
+		// Data that is still fresh keeps its expiry.
+		if retryAt := c.lastAttempt.Add(c.retryDelay()); retryAt.After(c.expiresAt) {
+			c.expiresAt = retryAt
+		}
+	}
+	c.mutex.Unlock()
+
+	c.refreshMu.Lock()
+	c.inflight = nil
+	c.refreshMu.Unlock()
+	close(call.done)
 }
 
-func RefreshCache() error {
+func (c *Cache) refresh(ctx context.Context) error {
 	var newData models.Datas
-	err := fetchAllData(&newData)
+	err := c.fetchAllData(ctx, &newData)
 	if err != nil {
 		return err
 	}
+	index := c.prepare(ctx, &newData)
 
-	cache.mutex.Lock()
-	defer cache.mutex.Unlock()
-
-	cache.data = newData
-	cache.expiresAt = time.Now().Add(duration)
+	now := time.Now()
+	c.mutex.Lock()
+	c.data = newData
+	c.index = index
+	c.fetchedAt = now
+	c.expiresAt = now.Add(c.duration)
+	c.mutex.Unlock()
 
+	c.saveSnapshot(newData, now)
 	return nil
 }
 
-func GetCachedData() (models.Datas, error) {
-	cache.mutex.RLock()
-	if time.Now().Before(cache.expiresAt) {
-		defer cache.mutex.RUnlock()
-		return cache.data, nil
+// prepare derives the typed values and search index the handlers rely on
+// from freshly loaded raw data, logging any data-quality issues found along
+// the way. The index is complete before it is swapped in with the data.
+func (c *Cache) prepare(ctx context.Context, data *models.Datas) *search.Index {
+	issues := dates.Annotate(data)
+	for _, issue := range issues {
+		c.logger.WarnContext(ctx, "Data issue", "artist", issue.ArtistID, "field", issue.Field, "issue", issue.Message)
 	}
-	cache.mutex.RUnlock()
+	return search.Build(*data)
+}
 
-	if err := RefreshCache(); err != nil {
-		return models.Datas{}, err
-	}
+// GetCachedData returns the cached datasets. Once they expire the last good
+// copy keeps being served while a single background refresh renews it; only
+// a cache that has never been loaded blocks the caller on the upstream.
+// Refreshes it starts are logged with the request ID in ctx.
+func (c *Cache) GetCachedData(ctx context.Context) (models.Datas, error) {
+	data, _, err := c.current(ctx)
+	return data, err
+}
 
-	return cache.data, nil
+// GetIndex returns the search index built from the cached datasets, with the
+// same freshness rules as GetCachedData. The index and data are always
+// swapped together, so the index matches the data served alongside it.
+func (c *Cache) GetIndex(ctx context.Context) (*search.Index, error) {
+	_, index, err := c.current(ctx)
+	return index, err
 }
 
-func fetchAllData(data *models.Datas) error {
-	var wg sync.WaitGroup
-	errChan := make(chan error, 4)
+func (c *Cache) current(ctx context.Context) (models.Datas, *search.Index, error) {
+	c.mutex.RLock()
+	data, index, loaded := c.data, c.index, !c.fetchedAt.IsZero()
+	stale := time.Now().After(c.expiresAt)
+	c.mutex.RUnlock()
 
-	wg.Add(4)
-	go fetchData(service.GetArtistsAPI(), &data.ArtistsData, &wg, errChan)
-	go fetchData(service.GetLocationsAPI(), &data.LocationsData, &wg, errChan)
-	go fetchData(service.GetDatesAPI(), &data.DatesData, &wg, errChan)
-	go fetchData(service.GetRelationsAPI(), &data.RelationsData, &wg, errChan)
+	if loaded {
+		if stale {
+			c.metrics.lookups.With("stale").Inc()
+			c.revalidate(ctx)
+		} else {
+			c.metrics.lookups.With("hit").Inc()
+		}
+		return data, index, nil
+	}
+
+	c.metrics.lookups.With("miss").Inc()
+	c.logger.InfoContext(ctx, "No data loaded yet, fetching from the upstream")
 
+	if err := c.RefreshCache(ctx); err != nil {
+		return models.Datas{}, nil, err
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.data, c.index, nil
+}
+
+// revalidate starts a background refresh unless one is already running.
+// The refresh outlives the request that started it but logs with its ID.
+func (c *Cache) revalidate(ctx context.Context) {
+	call, leader := c.beginRefresh()
+	if !leader {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	c.logger.InfoContext(ctx, "Data expired, refreshing in the background")
 	go func() {
-		wg.Wait()
-		close(errChan)
+		c.runRefresh(ctx, call)
+		if call.err != nil {
+			c.logger.WarnContext(ctx, "Background cache refresh failed, serving stale data", "error", call.err)
+		}
 	}()
+}
 
-	for err := range errChan {
-		if err != nil {
-			return err
-		}
+// Close stops the background refresher and cancels any in-flight refresh,
+// waiting for it so nothing touches the upstream or the snapshot once it
+// returns. Refreshes fail once the cache is closed; the data already loaded
+// is still served.
+func (c *Cache) Close() {
+	c.cancelClosing()
+	c.StopRefresher()
+	c.waitRefresh()
+}
+
+// waitRefresh blocks until any in-flight refresh has finished.
+func (c *Cache) waitRefresh() {
+	c.refreshMu.Lock()
+	call := c.inflight
+	c.refreshMu.Unlock()
+	if call != nil {
+		<-call.done
 	}
+}
 
-	return nil
+// LastRefresh reports when the data being served was fetched.
+func (c *Cache) LastRefresh() time.Time {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.fetchedAt
 }
 
-func fetchData(url string, target interface{}, wg *sync.WaitGroup, errChan chan<- error) {
-	defer wg.Done()
-	resp, err := http.Get(url)
-	if err != nil {
-		errChan <- fmt.Errorf("failed to fetch data from %s: %v", url, err)
-		return
+// Status describes the data a Cache is serving and its most recent
+// refresh.
+type Status struct {
+	// FetchedAt is when the data being served was fetched, zero until
+	// any is loaded, and ExpiresAt when it is due for renewal.
+	FetchedAt time.Time
+	ExpiresAt time.Time
+
+	// LastAttempt is when a refresh last finished and LastError its
+	// error, nil when it succeeded.
+	LastAttempt time.Time
+	LastError   error
+
+	// Artists counts the artists being served.
+	Artists int
+}
+
+// Status reports what the cache is serving and how its last refresh went.
+func (c *Cache) Status() Status {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return Status{
+		FetchedAt:   c.fetchedAt,
+		ExpiresAt:   c.expiresAt,
+		LastAttempt: c.lastAttempt,
+		LastError:   c.lastErr,
+		Artists:     len(c.data.ArtistsData),
 	}
-	defer resp.Body.Close()
+}
+
+// Age reports how old the data being served is, or zero if nothing is loaded.
+func (c *Cache) Age() time.Duration {
+	fetchedAt := c.LastRefresh()
+	if fetchedAt.IsZero() {
+		return 0
+	}
+	return time.Since(fetchedAt)
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
-		errChan <- fmt.Errorf("failed to decode data from %s: %v", url, err)
+// fetchAllData fetches the four datasets at once. The first failure
+// cancels the other fetches and is the error returned.
+func (c *Cache) fetchAllData(ctx context.Context, data *models.Datas) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errChan := make(chan error, 4)
+	src := c.source
+
+	wg.Add(4)
+	go c.fetchData(ctx, cancel, "artists", func(ctx context.Context) (err error) {
+		data.ArtistsData, err = src.FetchArtists(ctx)
+		return err
+	}, &wg, errChan)
+	go c.fetchData(ctx, cancel, "locations", func(ctx context.Context) (err error) {
+		data.LocationsData, err = src.FetchLocations(ctx)
+		return err
+	}, &wg, errChan)
+	go c.fetchData(ctx, cancel, "dates", func(ctx context.Context) (err error) {
+		data.DatesData, err = src.FetchDates(ctx)
+		return err
+	}, &wg, errChan)
+	go c.fetchData(ctx, cancel, "relations", func(ctx context.Context) (err error) {
+		data.RelationsData, err = src.FetchRelations(ctx)
+		return err
+	}, &wg, errChan)
+
+	wg.Wait()
+	close(errChan)
+	return <-errChan
+}
+
+// fetchData runs one dataset's fetch, timing it under dataset. A failure is
+// reported before cancel stops the other fetches, so it is the first error
+// on errChan.
+func (c *Cache) fetchData(ctx context.Context, cancel context.CancelFunc, dataset string, fetch func(context.Context) error, wg *sync.WaitGroup, errChan chan<- error) {
+	defer wg.Done()
+	start := time.Now()
+	err := fetch(ctx)
+	c.metrics.observeFetch(dataset, start, err)
+	if err != nil {
+		errChan <- err
+		cancel()
 	}
 }
@@ -0,0 +1,541 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"groupie-tracker/internal/metrics"
+	"groupie-tracker/internal/models"
+)
+
+const fixturesDir = "../handlers/testdata"
+
+// fixtureServer serves the handler fixtures the way the upstream API does.
+func fixtureServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := os.ReadFile(filepath.Join(fixturesDir, filepath.Base(r.URL.Path)+".json"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestHTTPSource tests fetching every dataset from an API compatible server
+func TestHTTPSource(t *testing.T) {
+	srv := fixtureServer(t)
+	c := New(time.Hour, NewHTTPSource(srv.URL+"/api/"))
+
+	if err := c.RefreshCache(context.Background()); err != nil {
+		t.Fatalf("c.RefreshCache(context.Background()) error = %v", err)
+	}
+
+	data, err := c.GetCachedData(context.Background())
+	if err != nil {
+		t.Fatalf("c.GetCachedData(context.Background()) error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		got      int
+		expected int
+	}{
+		{"Artists", len(data.ArtistsData), 4},
+		{"Locations", len(data.LocationsData.Index), 4},
+		{"Dates", len(data.DatesData.Index), 4},
+		{"Relations", len(data.RelationsData.Index), 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.expected {
+				t.Errorf("%s length = %d, want %d", tt.name, tt.got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestHTTPSourceErrors tests that upstream failures surface as errors
+func TestHTTPSourceErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/dates" {
+			http.Error(w, "boom", http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	c := New(time.Hour, NewHTTPSource(srv.URL+"/api"))
+	if err := c.RefreshCache(context.Background()); err == nil {
+		t.Error("c.RefreshCache(context.Background()) error = nil, want error for failing endpoint")
+	}
+}
+
+// TestFileSource tests reading every dataset from a fixture directory
+func TestFileSource(t *testing.T) {
+	c := New(time.Hour, NewFileSource(fixturesDir))
+	if err := c.RefreshCache(context.Background()); err != nil {
+		t.Fatalf("c.RefreshCache(context.Background()) error = %v", err)
+	}
+
+	data, err := c.GetCachedData(context.Background())
+	if err != nil {
+		t.Fatalf("c.GetCachedData(context.Background()) error = %v", err)
+	}
+	if len(data.ArtistsData) != 4 || data.ArtistsData[0].Name != "Queen" {
+		t.Errorf("ArtistsData = %+v, want the four fixture artists", data.ArtistsData)
+	}
+
+	c = New(time.Hour, NewFileSource(t.TempDir()))
+	if err := c.RefreshCache(context.Background()); err == nil {
+		t.Error("c.RefreshCache(context.Background()) error = nil, want error for missing files")
+	}
+}
+
+// countingSource wraps a DataSource, counting artist fetches and optionally
+// failing or stalling them.
+type countingSource struct {
+	DataSource
+	mu      sync.Mutex
+	fetches int
+	fail    bool
+	delay   time.Duration
+}
+
+func (s *countingSource) FetchArtists(ctx context.Context) ([]models.Artist, error) {
+	s.mu.Lock()
+	s.fetches++
+	fail, delay := s.fail, s.delay
+	s.mu.Unlock()
+
+	time.Sleep(delay)
+	if fail {
+		return nil, errors.New("upstream unavailable")
+	}
+	return s.DataSource.FetchArtists(ctx)
+}
+
+func (s *countingSource) setFail(fail bool) {
+	s.mu.Lock()
+	s.fail = fail
+	s.mu.Unlock()
+}
+
+func (s *countingSource) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+// TestGetCachedDataServesStale tests that expired data is still served when
+// the upstream is down
+func TestGetCachedDataServesStale(t *testing.T) {
+	src := &countingSource{DataSource: NewFileSource(fixturesDir)}
+	c := New(50*time.Millisecond, src)
+	if err := c.RefreshCache(context.Background()); err != nil {
+		t.Fatalf("c.RefreshCache(context.Background()) error = %v", err)
+	}
+
+	src.setFail(true)
+	time.Sleep(60 * time.Millisecond)
+
+	data, err := c.GetCachedData(context.Background())
+	if err != nil {
+		t.Fatalf("c.GetCachedData(context.Background()) error = %v, want stale data", err)
+	}
+	if len(data.ArtistsData) != 4 {
+		t.Errorf("ArtistsData length = %d, want 4", len(data.ArtistsData))
+	}
+	if c.Age() < 60*time.Millisecond {
+		t.Errorf("c.Age() = %v, want at least 60ms", c.Age())
+	}
+
+	// The failed background refresh holds off further fetches until the
+	// retry delay, a fifth of the cache duration, has passed
+	c.waitRefresh()
+	if src.count() != 2 {
+		t.Fatalf("fetches = %d, want the initial one and one background refresh", src.count())
+	}
+	for i := 0; i < 5; i++ {
+		c.GetCachedData(context.Background())
+	}
+	c.waitRefresh()
+	if src.count() != 2 {
+		t.Errorf("fetches = %d after the refresh failed, want no retry before the retry delay", src.count())
+	}
+
+	time.Sleep(15 * time.Millisecond)
+	c.GetCachedData(context.Background())
+	c.waitRefresh()
+	if src.count() != 3 {
+		t.Errorf("fetches = %d after the retry delay, want one more", src.count())
+	}
+}
+
+// TestFailedRefreshKeepsExpiry tests that a refresh failing before the data
+// expires, as the background refresher's do, leaves the expiry alone
+func TestFailedRefreshKeepsExpiry(t *testing.T) {
+	src := &countingSource{DataSource: NewFileSource(fixturesDir)}
+	c := New(time.Hour, src)
+	if err := c.RefreshCache(context.Background()); err != nil {
+		t.Fatalf("RefreshCache() error = %v", err)
+	}
+	expiresAt := c.Status().ExpiresAt
+
+	src.setFail(true)
+	if err := c.RefreshCache(context.Background()); err == nil {
+		t.Fatal("RefreshCache() error = nil, want the upstream failure")
+	}
+	if got := c.Status().ExpiresAt; !got.Equal(expiresAt) {
+		t.Errorf("Status().ExpiresAt = %v after a failed refresh, want it kept at %v", got, expiresAt)
+	}
+}
+
+// TestRefreshCacheSingleFlight tests that a burst of refreshes shares one
+// upstream fetch
+func TestRefreshCacheSingleFlight(t *testing.T) {
+	src := &countingSource{DataSource: NewFileSource(fixturesDir), delay: 20 * time.Millisecond}
+	c := New(time.Hour, src)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.GetCachedData(context.Background()); err != nil {
+				t.Errorf("c.GetCachedData(context.Background()) error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := src.count(); got != 1 {
+		t.Errorf("upstream fetches = %d, want 1", got)
+	}
+}
+
+// TestRefresher tests that the background refresher renews data before it
+// expires
+func TestRefresher(t *testing.T) {
+	src := &countingSource{DataSource: NewFileSource(fixturesDir)}
+	c := New(50*time.Millisecond, src)
+	if err := c.RefreshCache(context.Background()); err != nil {
+		t.Fatalf("c.RefreshCache(context.Background()) error = %v", err)
+	}
+
+	c.StartRefresher()
+	time.Sleep(120 * time.Millisecond)
+	c.StopRefresher()
+
+	if got := src.count(); got < 2 {
+		t.Errorf("upstream fetches = %d, want the refresher to have run", got)
+	}
+}
+
+// TestSnapshot tests saving a snapshot on refresh and restoring it at boot
+func TestSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshots", "snapshot.json")
+
+	c := New(time.Hour, NewFileSource(fixturesDir))
+	c.SetSnapshot(path, false)
+	if err := c.RefreshCache(context.Background()); err != nil {
+		t.Fatalf("c.RefreshCache(context.Background()) error = %v", err)
+	}
+	saved := c.LastRefresh()
+
+	c = New(time.Hour, NewFileSource(t.TempDir()))
+	c.SetSnapshot(path, false)
+	if err := c.RefreshCache(context.Background()); err == nil {
+		t.Fatal("c.RefreshCache(context.Background()) error = nil, want error for missing files")
+	}
+	if err := c.LoadSnapshot(); err != nil {
+		t.Fatalf("c.LoadSnapshot() error = %v", err)
+	}
+
+	data, err := c.GetCachedData(context.Background())
+	if err != nil {
+		t.Fatalf("c.GetCachedData(context.Background()) error = %v", err)
+	}
+	if len(data.ArtistsData) != 4 {
+		t.Errorf("ArtistsData length = %d, want 4", len(data.ArtistsData))
+	}
+	if !c.LastRefresh().Equal(saved) {
+		t.Errorf("c.LastRefresh() = %v, want snapshot time %v", c.LastRefresh(), saved)
+	}
+}
+
+// TestSnapshotRejected tests that stale and corrupted snapshots are not loaded
+func TestSnapshotRejected(t *testing.T) {
+	dir := t.TempDir()
+	data := models.Datas{ArtistsData: []models.Artist{{ID: 1, Name: "Queen"}}}
+
+	stale := filepath.Join(dir, "stale.json")
+	if err := WriteSnapshot(stale, data, time.Now().Add(-2*time.Hour)); err != nil {
+		t.Fatalf("WriteSnapshot() error = %v", err)
+	}
+
+	c := New(time.Hour, nil)
+	c.SetSnapshot(stale, false)
+	if err := c.LoadSnapshot(); !errors.Is(err, ErrStaleSnapshot) {
+		t.Errorf("c.LoadSnapshot() error = %v, want ErrStaleSnapshot", err)
+	}
+	c.SetSnapshot(stale, true)
+	if err := c.LoadSnapshot(); err != nil {
+		t.Errorf("c.LoadSnapshot() with stale allowed error = %v", err)
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.json")
+	if err := WriteSnapshot(corrupt, data, time.Now()); err != nil {
+		t.Fatalf("WriteSnapshot() error = %v", err)
+	}
+	content, err := os.ReadFile(corrupt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content = []byte(strings.Replace(string(content), "Queen", "Qveen", 1))
+	if err := os.WriteFile(corrupt, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ReadSnapshot(corrupt); err == nil {
+		t.Error("ReadSnapshot() error = nil, want checksum failure")
+	}
+}
+
+// TestIndexSwap tests that readers always see an index matching the data it
+// was built from while refreshes swap both in
+func TestIndexSwap(t *testing.T) {
+	c := New(time.Hour, NewFileSource(fixturesDir))
+	if err := c.RefreshCache(context.Background()); err != nil {
+		t.Fatalf("c.RefreshCache(context.Background()) error = %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if err := c.RefreshCache(context.Background()); err != nil {
+					t.Errorf("c.RefreshCache(context.Background()) error = %v", err)
+				}
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		data, index, err := c.current(context.Background())
+		if err != nil {
+			t.Fatalf("c.current(context.Background()) error = %v", err)
+		}
+		if index.Len() != len(data.ArtistsData) {
+			t.Fatalf("index has %d artists, data has %d", index.Len(), len(data.ArtistsData))
+		}
+	}
+	wg.Wait()
+}
+
+// staticSource serves a fixed list of artists and no concerts.
+type staticSource []models.Artist
+
+func (s staticSource) FetchArtists(context.Context) ([]models.Artist, error) {
+	return s, nil
+}
+
+func (s staticSource) FetchLocations(context.Context) (models.Location, error) {
+	return models.Location{}, nil
+}
+
+func (s staticSource) FetchDates(context.Context) (models.Date, error) {
+	return models.Date{}, nil
+}
+
+func (s staticSource) FetchRelations(context.Context) (models.Relation, error) {
+	return models.Relation{}, nil
+}
+
+// TestIndependentCaches tests that caches over different upstreams keep
+// their own data
+func TestIndependentCaches(t *testing.T) {
+	a := New(time.Hour, staticSource{{ID: 1, Name: "Queen"}})
+	b := New(time.Hour, staticSource{{ID: 2, Name: "SOJA"}, {ID: 3, Name: "Pink Floyd"}})
+	defer a.Close()
+	defer b.Close()
+
+	for _, c := range []*Cache{a, b} {
+		if err := c.RefreshCache(context.Background()); err != nil {
+			t.Fatalf("RefreshCache() error = %v", err)
+		}
+	}
+
+	for _, tt := range []struct {
+		cache    *Cache
+		expected int
+	}{{a, 1}, {b, 2}} {
+		index, err := tt.cache.GetIndex(context.Background())
+		if err != nil {
+			t.Fatalf("GetIndex() error = %v", err)
+		}
+		if index.Len() != tt.expected {
+			t.Errorf("index has %d artists, want %d", index.Len(), tt.expected)
+		}
+	}
+}
+
+// TestStatus tests that the status reports the data served and the last
+// refresh, failed or not
+func TestStatus(t *testing.T) {
+	src := &countingSource{DataSource: NewFileSource(fixturesDir)}
+	c := New(time.Hour, src)
+
+	if status := c.Status(); !status.FetchedAt.IsZero() || status.Artists != 0 {
+		t.Errorf("Status() before loading = %+v, want nothing loaded", status)
+	}
+
+	if err := c.RefreshCache(context.Background()); err != nil {
+		t.Fatalf("RefreshCache() error = %v", err)
+	}
+	loaded := c.Status()
+	if loaded.Artists != 4 || loaded.FetchedAt.IsZero() || loaded.LastError != nil {
+		t.Errorf("Status() after refresh = %+v, want 4 artists and no error", loaded)
+	}
+
+	src.setFail(true)
+	if err := c.RefreshCache(context.Background()); err == nil {
+		t.Fatal("RefreshCache() error = nil, want the upstream failure")
+	}
+	failed := c.Status()
+	if failed.LastError == nil || !failed.LastAttempt.After(loaded.LastAttempt) {
+		t.Errorf("Status() after failed refresh = %+v, want the failure recorded", failed)
+	}
+	if failed.Artists != 4 || !failed.FetchedAt.Equal(loaded.FetchedAt) {
+		t.Errorf("Status() after failed refresh = %+v, want the previous data still served", failed)
+	}
+}
+
+// TestMetrics tests that lookups, refreshes and upstream fetches are
+// counted
+func TestMetrics(t *testing.T) {
+	src := &countingSource{DataSource: NewFileSource(fixturesDir)}
+	c := New(time.Hour, src)
+	reg := metrics.NewRegistry()
+	c.SetMetrics(reg)
+
+	c.GetCachedData(context.Background())
+	c.GetCachedData(context.Background())
+	src.setFail(true)
+	c.RefreshCache(context.Background())
+
+	var b strings.Builder
+	reg.WriteTo(&b)
+	for _, expected := range []string{
+		`groupie_cache_lookups_total{result="hit"} 1`,
+		`groupie_cache_lookups_total{result="miss"} 1`,
+		`groupie_cache_refreshes_total{result="error"} 1`,
+		`groupie_cache_refreshes_total{result="success"} 1`,
+		`groupie_upstream_fetch_duration_seconds_count{dataset="artists"} 2`,
+		`groupie_upstream_fetch_errors_total{dataset="artists"} 1`,
+		"groupie_cache_artists 4",
+	} {
+		if !strings.Contains(b.String(), expected) {
+			t.Errorf("metrics = %s\nwant them to contain %q", b.String(), expected)
+		}
+	}
+}
+
+// blockingSource fails FetchArtists when fail is set and holds every other
+// fetch until its context is done, recording that it was.
+type blockingSource struct {
+	fail      bool
+	cancelled chan struct{}
+}
+
+func (s *blockingSource) FetchArtists(ctx context.Context) ([]models.Artist, error) {
+	if s.fail {
+		return nil, errors.New("artists unavailable")
+	}
+	return nil, s.block(ctx)
+}
+
+func (s *blockingSource) FetchLocations(ctx context.Context) (models.Location, error) {
+	return models.Location{}, s.block(ctx)
+}
+
+func (s *blockingSource) FetchDates(ctx context.Context) (models.Date, error) {
+	return models.Date{}, s.block(ctx)
+}
+
+func (s *blockingSource) FetchRelations(ctx context.Context) (models.Relation, error) {
+	return models.Relation{}, s.block(ctx)
+}
+
+func (s *blockingSource) block(ctx context.Context) error {
+	<-ctx.Done()
+	select {
+	case s.cancelled <- struct{}{}:
+	default:
+	}
+	return ctx.Err()
+}
+
+// TestRefreshCancel tests that callers can stop waiting on a hung
+// upstream, that Close cancels the fetch and that one failed dataset
+// cancels the others
+func TestRefreshCancel(t *testing.T) {
+	t.Run("Caller gives up", func(t *testing.T) {
+		src := &blockingSource{cancelled: make(chan struct{}, 1)}
+		c := New(time.Hour, src)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		if _, err := c.GetCachedData(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("c.GetCachedData() error = %v, want context.DeadlineExceeded", err)
+		}
+		select {
+		case <-src.cancelled:
+			t.Error("the shared refresh was cancelled with the caller that started it")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		done := make(chan struct{})
+		go func() {
+			c.Close()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("c.Close() did not cancel the refresh in flight")
+		}
+		if err := c.RefreshCache(context.Background()); !errors.Is(err, context.Canceled) {
+			t.Errorf("c.RefreshCache() after Close error = %v, want context.Canceled", err)
+		}
+	})
+
+	t.Run("Failed dataset", func(t *testing.T) {
+		src := &blockingSource{fail: true, cancelled: make(chan struct{}, 3)}
+		c := New(time.Hour, src)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		err := c.RefreshCache(ctx)
+		if err == nil || err.Error() != "artists unavailable" {
+			t.Errorf("c.RefreshCache() error = %v, want the artists failure", err)
+		}
+		if len(src.cancelled) != 3 {
+			t.Errorf("%d other fetches cancelled, want 3", len(src.cancelled))
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"time"
+
+	"groupie-tracker/internal/metrics"
+)
+
+// cacheMetrics counts how requests for data were answered and times the
+// fetches from the upstream.
+type cacheMetrics struct {
+	lookups     *metrics.CounterVec
+	refreshes   *metrics.CounterVec
+	fetches     *metrics.HistogramVec
+	fetchErrors *metrics.CounterVec
+}
+
+func newCacheMetrics(reg *metrics.Registry) *cacheMetrics {
+	return &cacheMetrics{
+		lookups: reg.Counter("groupie_cache_lookups_total",
+			"Requests for cached data, by result: hit, stale (served while refreshing) or miss (waited for the upstream).",
+			"result"),
+		refreshes: reg.Counter("groupie_cache_refreshes_total",
+			"Refreshes from the upstream, by result: success or error.",
+			"result"),
+		fetches: reg.Histogram("groupie_upstream_fetch_duration_seconds",
+			"Time taken to fetch each dataset from the upstream.",
+			metrics.DefaultBuckets, "dataset"),
+		fetchErrors: reg.Counter("groupie_upstream_fetch_errors_total",
+			"Failed fetches from the upstream, by dataset.",
+			"dataset"),
+	}
+}
+
+// SetMetrics registers the lookup, refresh and upstream fetch metrics on reg,
+// with gauges for the age and size of the data being served. Counts taken
+// before the call are not carried over, so it belongs in setup, before the
+// first refresh.
+func (c *Cache) SetMetrics(reg *metrics.Registry) {
+	c.metrics = newCacheMetrics(reg)
+	reg.GaugeFunc("groupie_cache_age_seconds",
+		"Age of the data being served, zero until any is loaded.",
+		func() float64 { return c.Age().Seconds() })
+	reg.GaugeFunc("groupie_cache_artists",
+		"Number of artists being served.",
+		func() float64 { return float64(c.Status().Artists) })
+}
+
+// observeFetch records one fetch of dataset that started at start.
+func (m *cacheMetrics) observeFetch(dataset string, start time.Time, err error) {
+	m.fetches.With(dataset).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.fetchErrors.With(dataset).Inc()
+	}
+}
+
+// observeRefresh records the result of one refresh.
+func (m *cacheMetrics) observeRefresh(err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	m.refreshes.With(result).Inc()
+}
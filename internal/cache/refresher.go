@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// refreshLead is the fraction of the cache duration before expiry at
+	// which the background refresher renews the data.
+	refreshLead = 5
+
+	// maxRetryDelay caps how long the refresher waits after a failed fetch.
+	maxRetryDelay = time.Minute
+)
+
+// StartRefresher launches a goroutine that renews the cached data shortly
+// before it expires, so requests never wait on the upstream. Failed
+// refreshes are retried while the last good data keeps being served.
+func (c *Cache) StartRefresher() {
+	c.StopRefresher()
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	c.refreshMu.Lock()
+	c.stopRefresher = stop
+	c.refresherDone = done
+	c.refreshMu.Unlock()
+
+	go c.runRefresher(stop, done)
+}
+
+// StopRefresher stops the background refresher, if running, and waits for
+// it to exit.
+func (c *Cache) StopRefresher() {
+	c.refreshMu.Lock()
+	stop, done := c.stopRefresher, c.refresherDone
+	c.stopRefresher, c.refresherDone = nil, nil
+	c.refreshMu.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+func (c *Cache) runRefresher(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	timer := time.NewTimer(c.nextRefresh())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+		}
+
+		if err := c.RefreshCache(context.Background()); err != nil {
+			c.logger.Warn("Background cache refresh failed, serving stale data", "error", err)
+			timer.Reset(c.retryDelay())
+			continue
+		}
+		timer.Reset(c.nextRefresh())
+	}
+}
+
+// nextRefresh returns how long to wait before renewing the current data.
+func (c *Cache) nextRefresh() time.Duration {
+	c.mutex.RLock()
+	expiresAt := c.expiresAt
+	c.mutex.RUnlock()
+
+	wait := time.Until(expiresAt) - c.duration/refreshLead
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// retryDelay returns how long to wait after a failed refresh before trying
+// the upstream again, both in the refresher and for requests on stale data.
+func (c *Cache) retryDelay() time.Duration {
+	delay := c.duration / refreshLead
+	if delay > maxRetryDelay || delay <= 0 {
+		delay = maxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"groupie-tracker/internal/models"
+)
+
+// snapshotVersion is bumped whenever the snapshot layout or models.Datas
+// changes incompatibly; snapshots with another version are ignored.
+const snapshotVersion = 1
+
+// ErrStaleSnapshot is returned when a snapshot is older than the cache
+// duration and stale snapshots are not allowed.
+var ErrStaleSnapshot = errors.New("snapshot is stale")
+
+type snapshotFile struct {
+	Version  int             `json:"version"`
+	SavedAt  time.Time       `json:"savedAt"`
+	Checksum string          `json:"checksum"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// SetSnapshot makes every successful refresh write the data to path, and
+// lets LoadSnapshot restore it. allowStale accepts snapshots older than the
+// cache duration. An empty path disables snapshots.
+func (c *Cache) SetSnapshot(path string, allowStale bool) {
+	c.snapshotPath = path
+	c.allowStaleSnapshot = allowStale
+}
+
+// LoadSnapshot fills the cache from the configured snapshot file. It is
+// meant for boot when the upstream cannot be reached; the restored data
+// keeps its original age and is renewed like any other expired data.
+func (c *Cache) LoadSnapshot() error {
+	if c.snapshotPath == "" {
+		return errors.New("no snapshot path configured")
+	}
+
+	data, savedAt, err := ReadSnapshot(c.snapshotPath)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := savedAt.Add(c.duration)
+	if time.Now().After(expiresAt) && !c.allowStaleSnapshot {
+		return fmt.Errorf("%w: saved at %s", ErrStaleSnapshot, savedAt.Format(time.RFC3339))
+	}
+	index := c.prepare(context.Background(), &data)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.data = data
+	c.index = index
+	c.fetchedAt = savedAt
+	c.expiresAt = expiresAt
+
+	return nil
+}
+
+// WriteSnapshot atomically writes data to path. The file is written next to
+// its destination and renamed into place, so readers only ever see a
+// complete snapshot.
+func WriteSnapshot(path string, data models.Datas, savedAt time.Time) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %v", err)
+	}
+
+	sum := sha256.Sum256(payload)
+	content, err := json.Marshal(snapshotFile{
+		Version:  snapshotVersion,
+		SavedAt:  savedAt.UTC(),
+		Checksum: hex.EncodeToString(sum[:]),
+		Data:     payload,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %v", err)
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".snapshot-*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write snapshot: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write snapshot: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace snapshot: %v", err)
+	}
+	return nil
+}
+
+// ReadSnapshot reads and verifies a snapshot written by WriteSnapshot.
+func ReadSnapshot(path string) (models.Datas, time.Time, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return models.Datas{}, time.Time{}, fmt.Errorf("failed to read snapshot: %v", err)
+	}
+
+	var file snapshotFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return models.Datas{}, time.Time{}, fmt.Errorf("failed to decode snapshot %s: %v", path, err)
+	}
+
+	if file.Version != snapshotVersion {
+		return models.Datas{}, time.Time{}, fmt.Errorf("snapshot %s has version %d, want %d", path, file.Version, snapshotVersion)
+	}
+
+	sum := sha256.Sum256(file.Data)
+	if hex.EncodeToString(sum[:]) != file.Checksum {
+		return models.Datas{}, time.Time{}, fmt.Errorf("snapshot %s failed checksum verification", path)
+	}
+
+	var data models.Datas
+	if err := json.Unmarshal(file.Data, &data); err != nil {
+		return models.Datas{}, time.Time{}, fmt.Errorf("failed to decode snapshot %s: %v", path, err)
+	}
+
+	return data, file.SavedAt, nil
+}
+
+// saveSnapshot writes the configured snapshot, logging rather than failing
+// the refresh when it cannot.
+func (c *Cache) saveSnapshot(data models.Datas, savedAt time.Time) {
+	if c.snapshotPath == "" {
+		return
+	}
+	if err := WriteSnapshot(c.snapshotPath, data, savedAt); err != nil {
+		c.logger.Error("Failed to save cache snapshot", "path", c.snapshotPath, "error", err)
+	}
+}
@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"groupie-tracker/internal/models"
+	"groupie-tracker/internal/service"
+)
+
+// DataSource provides the four upstream datasets the cache is built from.
+// Fetches give up when ctx is done.
+type DataSource interface {
+	FetchArtists(ctx context.Context) ([]models.Artist, error)
+	FetchLocations(ctx context.Context) (models.Location, error)
+	FetchDates(ctx context.Context) (models.Date, error)
+	FetchRelations(ctx context.Context) (models.Relation, error)
+}
+
+// Endpoint names shared by the upstream API and on-disk fixtures.
+const (
+	artistsEndpoint   = "artists"
+	locationsEndpoint = "locations"
+	datesEndpoint     = "dates"
+	relationsEndpoint = "relation"
+)
+
+// HTTPSource fetches the datasets from a Groupie Trackers compatible API.
+// A nil Client falls back to http.DefaultClient, which has no timeout.
+type HTTPSource struct {
+	ArtistsURL   string
+	LocationsURL string
+	DatesURL     string
+	RelationsURL string
+	Client       *http.Client
+}
+
+// NewHTTPSource builds an HTTPSource whose endpoints live under baseURL.
+// An empty baseURL selects the public Groupie Trackers API.
+func NewHTTPSource(baseURL string) *HTTPSource {
+	if baseURL == "" {
+		return DefaultSource()
+	}
+	base := strings.TrimRight(baseURL, "/")
+	return &HTTPSource{
+		ArtistsURL:   base + "/" + artistsEndpoint,
+		LocationsURL: base + "/" + locationsEndpoint,
+		DatesURL:     base + "/" + datesEndpoint,
+		RelationsURL: base + "/" + relationsEndpoint,
+		Client:       http.DefaultClient,
+	}
+}
+
+// DefaultSource returns an HTTPSource for the public Groupie Trackers API.
+func DefaultSource() *HTTPSource {
+	return &HTTPSource{
+		ArtistsURL:   service.GetArtistsAPI(),
+		LocationsURL: service.GetLocationsAPI(),
+		DatesURL:     service.GetDatesAPI(),
+		RelationsURL: service.GetRelationsAPI(),
+		Client:       http.DefaultClient,
+	}
+}
+
+func (s *HTTPSource) FetchArtists(ctx context.Context) ([]models.Artist, error) {
+	var artists []models.Artist
+	err := s.get(ctx, s.ArtistsURL, &artists)
+	return artists, err
+}
+
+func (s *HTTPSource) FetchLocations(ctx context.Context) (models.Location, error) {
+	var locations models.Location
+	err := s.get(ctx, s.LocationsURL, &locations)
+	return locations, err
+}
+
+func (s *HTTPSource) FetchDates(ctx context.Context) (models.Date, error) {
+	var dates models.Date
+	err := s.get(ctx, s.DatesURL, &dates)
+	return dates, err
+}
+
+func (s *HTTPSource) FetchRelations(ctx context.Context) (models.Relation, error) {
+	var relations models.Relation
+	err := s.get(ctx, s.RelationsURL, &relations)
+	return relations, err
+}
+
+func (s *HTTPSource) get(ctx context.Context, url string, target interface{}) error {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to fetch data from %s: %v", url, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch data from %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch data from %s: unexpected status %s", url, resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("failed to decode data from %s: %v", url, err)
+	}
+	return nil
+}
+
+// FileSource reads the datasets from JSON files in a directory, using the
+// same shapes the upstream API returns: artists.json, locations.json,
+// dates.json and relation.json.
+type FileSource struct {
+	Dir string
+}
+
+// NewFileSource returns a FileSource reading from dir.
+func NewFileSource(dir string) *FileSource {
+	return &FileSource{Dir: dir}
+}
+
+func (s *FileSource) FetchArtists(ctx context.Context) ([]models.Artist, error) {
+	var artists []models.Artist
+	err := s.read(ctx, artistsEndpoint, &artists)
+	return artists, err
+}
+
+func (s *FileSource) FetchLocations(ctx context.Context) (models.Location, error) {
+	var locations models.Location
+	err := s.read(ctx, locationsEndpoint, &locations)
+	return locations, err
+}
+
+func (s *FileSource) FetchDates(ctx context.Context) (models.Date, error) {
+	var dates models.Date
+	err := s.read(ctx, datesEndpoint, &dates)
+	return dates, err
+}
+
+func (s *FileSource) FetchRelations(ctx context.Context) (models.Relation, error) {
+	var relations models.Relation
+	err := s.read(ctx, relationsEndpoint, &relations)
+	return relations, err
+}
+
+func (s *FileSource) read(ctx context.Context, name string, target interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	path := filepath.Join(s.Dir, name+".json")
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read data from %s: %v", path, err)
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(target); err != nil {
+		return fmt.Errorf("failed to decode data from %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,340 @@
+// Package config gathers the tracker's settings from a config file,
+// environment variables and command-line flags.
+//
+// Every setting has a flag name, such as cache-duration. The same name is
+// its key in a config file and, upper-cased with GROUPIE_ in front and
+// dashes turned into underscores, its environment variable
+// (GROUPIE_CACHE_DURATION). Flags override the environment, which overrides
+// the file, which overrides the defaults.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"groupie-tracker/internal/geocoding"
+	"groupie-tracker/internal/search"
+	"groupie-tracker/internal/service"
+)
+
+// EnvPrefix starts the name of every environment variable read.
+const EnvPrefix = "GROUPIE_"
+
+// Config holds every setting of the tracker.
+type Config struct {
+	// File is the config file the settings were read from, if any.
+	File string
+
+	Addr          string
+	CacheDuration time.Duration
+
+	// MaxStaleness is the oldest the data being served may be for the
+	// server to report itself ready.
+	MaxStaleness time.Duration
+
+	// Server timeouts: how long a client may take to send a request, how
+	// long a response may take, how long an idle keep-alive connection is
+	// kept, and how long shutdown waits for requests in flight.
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+
+	// UpstreamTimeout bounds every outbound request, to the data API and
+	// to the geocoding provider, including reading the response.
+	UpstreamTimeout time.Duration
+
+	Source        string
+	APIBase       string
+	DataDir       string
+	Snapshot      string
+	SnapshotStale bool
+
+	Geocoder       string
+	Gazetteer      string
+	GeocodeCache   string
+	GeocodeWorkers int
+	MapboxToken    string
+	MapboxAPI      string
+
+	// MapboxPublicToken is the token handed to browsers for map tiles,
+	// ideally a public token restricted to the site's URLs. Without it the
+	// browser maps are off; the geocoding token is never served.
+	MapboxPublicToken string
+
+	// Now is the reference date concerts are classified against; zero
+	// means today.
+	Now   time.Time
+	Fuzzy int
+}
+
+// Default returns the settings used when nothing overrides them. The
+// Mapbox token has no default: it is a secret and must be supplied.
+func Default() Config {
+	return Config{
+		Addr:            ":8080",
+		CacheDuration:   time.Hour,
+		MaxStaleness:    3 * time.Hour,
+		ReadTimeout:     10 * time.Second,
+		WriteTimeout:    60 * time.Second,
+		IdleTimeout:     2 * time.Minute,
+		ShutdownTimeout: 30 * time.Second,
+		UpstreamTimeout: 10 * time.Second,
+		Source:          "api",
+		APIBase:         service.GetBaseAPI(),
+		DataDir:         "data",
+		Snapshot:        "data/snapshot.json",
+		Geocoder:        "mapbox",
+		Gazetteer:       geocoding.DefaultGazetteer,
+		GeocodeCache:    "data/geocode-cache.json",
+		GeocodeWorkers:  geocoding.DefaultWorkers,
+		MapboxAPI:       service.GetMapboxGeocodingAPI(),
+		Fuzzy:           search.DefaultMaxEdits,
+	}
+}
+
+// Load reads the settings from args (without the program name), the
+// environment as seen through lookupEnv and the config file named by the
+// config flag or GROUPIE_CONFIG, then validates them. Usage and flag
+// errors are written to output; -h yields flag.ErrHelp.
+func Load(args []string, lookupEnv func(string) (string, bool), output io.Writer) (Config, error) {
+	cfg := Default()
+	fs := flags(&cfg)
+	fs.SetOutput(output)
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	if !explicit["config"] {
+		if path, ok := lookupEnv(envName("config")); ok {
+			cfg.File = path
+		}
+	}
+	if cfg.File != "" {
+		settings, err := readFile(cfg.File)
+		if err != nil {
+			return cfg, err
+		}
+		for _, s := range settings {
+			if explicit[s.name] {
+				continue
+			}
+			if err := set(fs, s.name, s.value, s.source); err != nil {
+				return cfg, err
+			}
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || f.Name == "config" || explicit[f.Name] {
+			return
+		}
+		name := envName(f.Name)
+		if value, ok := lookupEnv(name); ok {
+			err = set(fs, f.Name, value, name)
+		}
+	})
+	if err != nil {
+		return cfg, err
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// flags registers a flag for every setting, bound to cfg.
+func flags(cfg *Config) *flag.FlagSet {
+	fs := flag.NewFlagSet("groupie-tracker", flag.ContinueOnError)
+	fs.StringVar(&cfg.File, "config", cfg.File, "JSON or YAML file to read settings from (also "+envName("config")+")")
+	fs.StringVar(&cfg.Addr, "addr", cfg.Addr, "address the server listens on")
+	fs.DurationVar(&cfg.CacheDuration, "cache-duration", cfg.CacheDuration, "how long fetched data is served before it is refreshed")
+	fs.DurationVar(&cfg.MaxStaleness, "max-staleness", cfg.MaxStaleness, "oldest the served data may be for /readyz to report ready")
+	fs.DurationVar(&cfg.ReadTimeout, "read-timeout", cfg.ReadTimeout, "longest a client may take to send a request")
+	fs.DurationVar(&cfg.WriteTimeout, "write-timeout", cfg.WriteTimeout, "longest a response may take, including geocoding an artist's concerts")
+	fs.DurationVar(&cfg.IdleTimeout, "idle-timeout", cfg.IdleTimeout, "how long an idle keep-alive connection is kept open")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "how long shutdown waits for requests in flight before closing their connections")
+	fs.DurationVar(&cfg.UpstreamTimeout, "upstream-timeout", cfg.UpstreamTimeout, "longest a request to the data API or the geocoding provider may take")
+	fs.StringVar(&cfg.Source, "source", cfg.Source, "upstream data source: \"api\" or \"file\"")
+	fs.StringVar(&cfg.APIBase, "api", cfg.APIBase, "base URL of the Groupie Trackers API (with -source=api)")
+	fs.StringVar(&cfg.DataDir, "data-dir", cfg.DataDir, "directory holding artists.json, locations.json, dates.json and relation.json (with -source=file)")
+	fs.StringVar(&cfg.Snapshot, "snapshot", cfg.Snapshot, "file the cached data is saved to and restored from when the upstream is unreachable at boot (empty disables)")
+	fs.BoolVar(&cfg.SnapshotStale, "snapshot-stale", cfg.SnapshotStale, "accept a snapshot older than the cache duration at boot")
+	fs.StringVar(&cfg.Geocoder, "geocoder", cfg.Geocoder, "geocoding provider: \"mapbox\" or \"gazetteer\" (offline)")
+	fs.StringVar(&cfg.Gazetteer, "gazetteer", cfg.Gazetteer, "gazetteer CSV file (with -geocoder=gazetteer)")
+	fs.StringVar(&cfg.GeocodeCache, "geocode-cache", cfg.GeocodeCache, "file geocoding results are cached in (empty keeps them in memory only)")
+	fs.IntVar(&cfg.GeocodeWorkers, "geocode-workers", cfg.GeocodeWorkers, "maximum concurrent geocoding lookups")
+	fs.StringVar(&cfg.MapboxToken, "mapbox-token", cfg.MapboxToken, "Mapbox access token (with -geocoder=mapbox); prefer "+envName("mapbox-token")+" over the flag")
+	fs.StringVar(&cfg.MapboxPublicToken, "mapbox-public-token", cfg.MapboxPublicToken, "public Mapbox token served to browsers for the maps, e.g. one restricted to this site's URLs; maps are off without it")
+	fs.StringVar(&cfg.MapboxAPI, "mapbox-api", cfg.MapboxAPI, "Mapbox forward geocoding API URL")
+	fs.Var((*date)(&cfg.Now), "now", "reference date (YYYY-MM-DD) concerts are classified as past or upcoming against; defaults to today")
+	fs.IntVar(&cfg.Fuzzy, "fuzzy", cfg.Fuzzy, "typo tolerance for search and suggestions, in edits per word (0 disables)")
+	return fs
+}
+
+// set assigns a setting read from source, a file position or an
+// environment variable.
+func set(fs *flag.FlagSet, name, value, source string) error {
+	if name == "config" || fs.Lookup(name) == nil {
+		return fmt.Errorf("%s: unknown setting %q", source, name)
+	}
+	if err := fs.Set(name, value); err != nil {
+		return fmt.Errorf("%s: invalid %s %q: %v", source, name, value, err)
+	}
+	return nil
+}
+
+// envName is the environment variable of a setting.
+func envName(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+	var errs []error
+	invalid := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Addr); err != nil {
+		invalid("addr: %q is not a host:port address, want e.g. :8080", c.Addr)
+	}
+	if c.CacheDuration <= 0 {
+		invalid("cache-duration: must be positive, got %s", c.CacheDuration)
+	}
+	if c.MaxStaleness < c.CacheDuration {
+		invalid("max-staleness: must be at least cache-duration %s, got %s", c.CacheDuration, c.MaxStaleness)
+	}
+	for _, timeout := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"read-timeout", c.ReadTimeout},
+		{"write-timeout", c.WriteTimeout},
+		{"idle-timeout", c.IdleTimeout},
+		{"shutdown-timeout", c.ShutdownTimeout},
+		{"upstream-timeout", c.UpstreamTimeout},
+	} {
+		if timeout.value <= 0 {
+			invalid("%s: must be positive, got %s", timeout.name, timeout.value)
+		}
+	}
+
+	switch c.Source {
+	case "api":
+		if err := checkURL(c.APIBase); err != nil {
+			invalid("api: %v", err)
+		}
+	case "file":
+		if c.DataDir == "" {
+			invalid("data-dir: required with source=file")
+		}
+	default:
+		invalid("source: unknown data source %q, want \"api\" or \"file\"", c.Source)
+	}
+
+	switch c.Geocoder {
+	case "mapbox":
+		if c.MapboxToken == "" {
+			invalid("mapbox-token: required with geocoder=mapbox; set %s or use geocoder=gazetteer", envName("mapbox-token"))
+		}
+		if err := checkURL(c.MapboxAPI); err != nil {
+			invalid("mapbox-api: %v", err)
+		}
+	case "gazetteer":
+		if c.Gazetteer == "" {
+			invalid("gazetteer: required with geocoder=gazetteer")
+		}
+	default:
+		invalid("geocoder: unknown geocoder %q, want \"mapbox\" or \"gazetteer\"", c.Geocoder)
+	}
+	if strings.HasPrefix(c.MapboxPublicToken, "sk.") {
+		invalid("mapbox-public-token: is a secret sk. token, which must not reach browsers; use a public pk. token")
+	}
+	if c.GeocodeWorkers < 1 {
+		invalid("geocode-workers: must be at least 1, got %d", c.GeocodeWorkers)
+	}
+
+	if c.Fuzzy < 0 || c.Fuzzy > search.MaxEdits {
+		invalid("fuzzy: must be from 0 to %d, got %d", search.MaxEdits, c.Fuzzy)
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkURL requires an absolute http or https URL.
+func checkURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an http(s) URL", raw)
+	}
+	return nil
+}
+
+// Settings lists every setting with its value, secrets masked, in name
+// order, for logging at startup.
+func (c Config) Settings() []string {
+	fs := flags(&c)
+	var settings []string
+	fs.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if strings.HasSuffix(f.Name, "token") && value != "" {
+			value = "(set)"
+		}
+		settings = append(settings, f.Name+"="+value)
+	})
+	return settings
+}
+
+// BrowserMapboxToken returns the Mapbox token to serve to browsers: the
+// public token, or "" when none is configured. It never falls back to the
+// geocoding token, which may be a secret one.
+func (c Config) BrowserMapboxToken() string {
+	return c.MapboxPublicToken
+}
+
+// date is a flag.Value for a YYYY-MM-DD date; the zero time is unset.
+type date time.Time
+
+func (d *date) String() string {
+	if d == nil || time.Time(*d).IsZero() {
+		return ""
+	}
+	return time.Time(*d).Format(time.DateOnly)
+}
+
+func (d *date) Set(value string) error {
+	if value == "" {
+		*d = date{}
+		return nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return errors.New("want YYYY-MM-DD")
+	}
+	*d = date(t)
+	return nil
+}
+
+// readFile reads a config file, as JSON when its name ends in .json and
+// as YAML otherwise.
+func readFile(path string) ([]setting, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return parseJSON(path, data)
+	}
+	return parseYAML(path, data)
+}
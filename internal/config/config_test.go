@@ -0,0 +1,241 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// env returns a lookupEnv function over a fixed set of variables.
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestLoadDefaults tests the settings used when nothing overrides them
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load([]string{"-geocoder=gazetteer"}, env(nil), io.Discard)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	expected := Default()
+	expected.Geocoder = "gazetteer"
+	if cfg != expected {
+		t.Errorf("Load() = %+v, want %+v", cfg, expected)
+	}
+}
+
+// TestLoadPrecedence tests that flags override the environment, which
+// overrides the config file
+func TestLoadPrecedence(t *testing.T) {
+	yaml := writeFile(t, "config.yaml", `
+# settings
+addr: ":9000"
+cache-duration: 30m   # refresh twice an hour
+fuzzy: 1
+mapbox-token: 'from-file'
+now: "2019-06-01"
+`)
+	json := writeFile(t, "config.json", `{"addr": ":9000", "cache-duration": "30m", "fuzzy": 1, "mapbox-token": "from-file", "now": "2019-06-01"}`)
+
+	for _, path := range []string{yaml, json} {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			vars := map[string]string{
+				"GROUPIE_CONFIG":       path,
+				"GROUPIE_FUZZY":        "0",
+				"GROUPIE_ADDR":         ":9100",
+				"GROUPIE_MAPBOX_TOKEN": "from-env",
+			}
+			cfg, err := Load([]string{"-addr", ":9200"}, env(vars), io.Discard)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+
+			if cfg.File != path {
+				t.Errorf("File = %q, want %q", cfg.File, path)
+			}
+			if cfg.Addr != ":9200" {
+				t.Errorf("Addr = %q, want the flag's :9200", cfg.Addr)
+			}
+			if cfg.Fuzzy != 0 || cfg.MapboxToken != "from-env" {
+				t.Errorf("Fuzzy, MapboxToken = %d, %q, want the environment's 0, from-env", cfg.Fuzzy, cfg.MapboxToken)
+			}
+			if cfg.CacheDuration != 30*time.Minute {
+				t.Errorf("CacheDuration = %s, want the file's 30m", cfg.CacheDuration)
+			}
+			if expected := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC); !cfg.Now.Equal(expected) {
+				t.Errorf("Now = %s, want %s", cfg.Now, expected)
+			}
+			if cfg.Source != "api" {
+				t.Errorf("Source = %q, want the default api", cfg.Source)
+			}
+		})
+	}
+}
+
+// TestLoadConfigFlag tests that the config flag overrides GROUPIE_CONFIG
+func TestLoadConfigFlag(t *testing.T) {
+	path := writeFile(t, "config.yaml", "geocoder: gazetteer\n")
+	vars := map[string]string{"GROUPIE_CONFIG": filepath.Join(t.TempDir(), "missing.yaml")}
+	cfg, err := Load([]string{"-config", path}, env(vars), io.Discard)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Geocoder != "gazetteer" {
+		t.Errorf("Geocoder = %q, want gazetteer", cfg.Geocoder)
+	}
+}
+
+// TestLoadErrors tests that invalid settings are reported with where they
+// came from
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		args     []string
+		vars     map[string]string
+		expected []string
+	}{
+		{
+			name:     "Unknown file key",
+			file:     "config.yaml",
+			content:  "geocoder: gazetteer\ncolour: blue\n",
+			expected: []string{"config.yaml:2: unknown setting \"colour\""},
+		},
+		{
+			name:     "Nested YAML",
+			file:     "config.yaml",
+			content:  "cache:\n  duration: 1h\n",
+			expected: []string{"config.yaml:2: nested values are not supported"},
+		},
+		{
+			name:     "Duplicate YAML key",
+			file:     "config.yaml",
+			content:  "fuzzy: 1\nfuzzy: 2\n",
+			expected: []string{"config.yaml:2: fuzzy is set twice"},
+		},
+		{
+			name:     "Unterminated quote",
+			file:     "config.yaml",
+			content:  "addr: \":9000\n",
+			expected: []string{"config.yaml:1: unterminated quoted value"},
+		},
+		{
+			name:     "JSON object value",
+			file:     "config.json",
+			content:  `{"cache": {"duration": "1h"}}`,
+			expected: []string{"config.json: cache must be a string, number or boolean"},
+		},
+		{
+			name:     "Bad environment value",
+			args:     []string{"-geocoder=gazetteer"},
+			vars:     map[string]string{"GROUPIE_CACHE_DURATION": "soon"},
+			expected: []string{`GROUPIE_CACHE_DURATION: invalid cache-duration "soon"`},
+		},
+		{
+			name:     "Bad date",
+			args:     []string{"-geocoder=gazetteer", "-now", "01/06/2019"},
+			expected: []string{"want YYYY-MM-DD"},
+		},
+		{
+			name: "Every invalid setting",
+			args: []string{"-addr", "8080", "-cache-duration", "0s", "-max-staleness", "-1m", "-shutdown-timeout", "-1s", "-upstream-timeout", "0s", "-source", "ftp", "-geocode-workers", "0", "-fuzzy", "4"},
+			expected: []string{
+				`addr: "8080" is not a host:port address`,
+				"cache-duration: must be positive",
+				"max-staleness: must be at least cache-duration",
+				"shutdown-timeout: must be positive, got -1s",
+				"upstream-timeout: must be positive, got 0s",
+				`source: unknown data source "ftp"`,
+				"mapbox-token: required with geocoder=mapbox",
+				"geocode-workers: must be at least 1",
+				"fuzzy: must be from 0 to 3, got 4",
+			},
+		},
+		{
+			name:     "Secret public token",
+			args:     []string{"-geocoder=gazetteer", "-mapbox-public-token", "sk.secret"},
+			expected: []string{"mapbox-public-token: is a secret sk. token"},
+		},
+		{
+			name:     "Bad URL",
+			args:     []string{"-geocoder=gazetteer", "-api", "groupietrackers.herokuapp.com/api"},
+			expected: []string{`api: "groupietrackers.herokuapp.com/api" is not an http(s) URL`},
+		},
+		{
+			name:     "Missing file",
+			args:     []string{"-config", "does-not-exist.yaml"},
+			expected: []string{"reading config file"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append(args, "-config", writeFile(t, tt.file, tt.content))
+			}
+			_, err := Load(args, env(tt.vars), io.Discard)
+			if err == nil {
+				t.Fatal("Load() error = nil, want an error")
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("Load() error = %q, want it to mention %q", err, expected)
+				}
+			}
+		})
+	}
+}
+
+// TestLoadHelp tests that -h is reported as flag.ErrHelp
+func TestLoadHelp(t *testing.T) {
+	if _, err := Load([]string{"-h"}, env(nil), io.Discard); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("Load(-h) error = %v, want flag.ErrHelp", err)
+	}
+}
+
+// TestBrowserMapboxToken tests that browsers get the public token only,
+// never the geocoding token
+func TestBrowserMapboxToken(t *testing.T) {
+	cfg := Default()
+	cfg.MapboxToken = "sk.server"
+	if got := cfg.BrowserMapboxToken(); got != "" {
+		t.Errorf("BrowserMapboxToken() = %q, want none without a public token", got)
+	}
+	cfg.MapboxPublicToken = "pk.public"
+	if got := cfg.BrowserMapboxToken(); got != "pk.public" {
+		t.Errorf("BrowserMapboxToken() = %q, want the public token", got)
+	}
+}
+
+// TestSettings tests that the logged settings mask the Mapbox tokens
+func TestSettings(t *testing.T) {
+	cfg := Default()
+	cfg.MapboxToken = "pk.secret"
+	cfg.MapboxPublicToken = "pk.public"
+	settings := strings.Join(cfg.Settings(), " ")
+	if strings.Contains(settings, "pk.secret") || strings.Contains(settings, "pk.public") {
+		t.Errorf("Settings() = %q, exposes the Mapbox token", settings)
+	}
+	if !strings.Contains(settings, "mapbox-token=(set)") || !strings.Contains(settings, "addr=:8080") {
+		t.Errorf("Settings() = %q, want mapbox-token=(set) and addr=:8080", settings)
+	}
+}
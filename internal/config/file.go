@@ -0,0 +1,112 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// setting is one key and value read from a config file, with where it was
+// found for error messages.
+type setting struct {
+	name   string
+	value  string
+	source string
+}
+
+// parseJSON reads a flat JSON object of settings. Values may be strings,
+// numbers or booleans.
+func parseJSON(path string, data []byte) ([]setting, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	settings := make([]setting, 0, len(object))
+	for _, name := range names {
+		var value string
+		switch v := object[name].(type) {
+		case string:
+			value = v
+		case json.Number:
+			value = v.String()
+		case bool:
+			value = strconv.FormatBool(v)
+		default:
+			return nil, fmt.Errorf("%s: %s must be a string, number or boolean", path, name)
+		}
+		settings = append(settings, setting{name: name, value: value, source: path})
+	}
+	return settings, nil
+}
+
+// parseYAML reads the subset of YAML a flat settings file needs: one
+// "key: value" per line, values optionally quoted, and # comments.
+func parseYAML(path string, data []byte) ([]setting, error) {
+	var settings []setting
+	seen := make(map[string]bool)
+	for i, line := range strings.Split(string(data), "\n") {
+		source := fmt.Sprintf("%s:%d", path, i+1)
+		line = strings.TrimRight(line, " \t\r")
+		if trimmed := strings.TrimSpace(line); trimmed == "" || trimmed[0] == '#' || trimmed == "---" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("%s: nested values are not supported", source)
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s: want \"key: value\"", source)
+		}
+		name = strings.TrimSpace(name)
+		value, err := yamlValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", source, err)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%s: %s is set twice", source, name)
+		}
+		seen[name] = true
+		settings = append(settings, setting{name: name, value: value, source: source})
+	}
+	return settings, nil
+}
+
+// yamlValue unquotes a scalar and strips a trailing comment.
+func yamlValue(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	switch quote := raw[0]; quote {
+	case '"', '\'':
+		end := strings.LastIndexByte(raw, quote)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated quoted value %s", raw)
+		}
+		if rest := strings.TrimSpace(raw[end+1:]); rest != "" && rest[0] != '#' {
+			return "", fmt.Errorf("unexpected %q after quoted value", rest)
+		}
+		if quote == '"' {
+			return strconv.Unquote(raw[:end+1])
+		}
+		return strings.ReplaceAll(raw[1:end], "''", "'"), nil
+	case '[', '{', '|', '>', '&', '*', '!':
+		return "", fmt.Errorf("value %s is not supported, want a plain or quoted scalar", raw)
+	}
+	if i := strings.Index(raw, " #"); i >= 0 {
+		raw = strings.TrimSpace(raw[:i])
+	}
+	return raw, nil
+}
@@ -0,0 +1,114 @@
+// Package dates parses and validates the upstream date strings once, when
+// the cache is loaded, so the rest of the server works with typed dates.
+package dates
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"groupie-tracker/internal/models"
+)
+
+// Layout is the upstream date format, DD-MM-YYYY, used for both first album
+// and concert dates.
+const Layout = "02-01-2006"
+
+// ParseFirstAlbum parses an artist's first album date, such as "14-12-1973".
+func ParseFirstAlbum(s string) (time.Time, error) {
+	t, err := time.Parse(Layout, strings.TrimSpace(s))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid first album date %q: want DD-MM-YYYY", s)
+	}
+	return t, nil
+}
+
+// ParseConcert parses a concert date such as "23-08-2019". The dates API
+// prefixes some dates with a "*" marker, which is ignored.
+func ParseConcert(s string) (time.Time, error) {
+	trimmed := strings.TrimPrefix(strings.TrimSpace(s), "*")
+	t, err := time.Parse(Layout, trimmed)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid concert date %q: want DD-MM-YYYY", s)
+	}
+	return t, nil
+}
+
+// Annotate validates every date in data, storing the parsed values next to
+// the raw strings: Artist.FirstAlbumDate, and Datas.ConcertDates and
+// Datas.RelationDates, sorted chronologically. Values that fail to parse
+// are left zero or omitted and recorded in Datas.Issues, which is also
+// returned.
+func Annotate(data *models.Datas) []models.DataIssue {
+	var issues []models.DataIssue
+
+	for i := range data.ArtistsData {
+		artist := &data.ArtistsData[i]
+		parsed, err := ParseFirstAlbum(artist.FirstAlbum)
+		if err != nil {
+			issues = append(issues, issue(artist.ID, "firstAlbum", artist.FirstAlbum, err))
+		}
+		artist.FirstAlbumDate = parsed
+	}
+
+	data.ConcertDates = make(map[int][]time.Time, len(data.DatesData.Index))
+	for _, entry := range data.DatesData.Index {
+		var concerts []time.Time
+		concerts, issues = parseConcerts(entry.ID, "concertDates", entry.Dates, issues)
+		data.ConcertDates[entry.ID] = concerts
+	}
+
+	data.RelationDates = make(map[int]map[string][]time.Time, len(data.RelationsData.Index))
+	for _, entry := range data.RelationsData.Index {
+		byLocation := make(map[string][]time.Time, len(entry.DatesLocations))
+		for location, raw := range entry.DatesLocations {
+			byLocation[location], issues = parseConcerts(entry.ID, "relations."+location, raw, issues)
+		}
+		data.RelationDates[entry.ID] = byLocation
+	}
+
+	sort.Slice(issues, func(i, j int) bool {
+		a, b := issues[i], issues[j]
+		if a.ArtistID != b.ArtistID {
+			return a.ArtistID < b.ArtistID
+		}
+		if a.Field != b.Field {
+			return a.Field < b.Field
+		}
+		return a.Value < b.Value
+	})
+	data.Issues = issues
+	return issues
+}
+
+// parseConcerts parses an artist's raw concert dates, appending the ones
+// that fail to issues under field, and returns the rest sorted.
+func parseConcerts(artistID int, field string, raw []string, issues []models.DataIssue) ([]time.Time, []models.DataIssue) {
+	concerts := make([]time.Time, 0, len(raw))
+	for _, d := range raw {
+		parsed, err := ParseConcert(d)
+		if err != nil {
+			issues = append(issues, issue(artistID, field, d, err))
+			continue
+		}
+		concerts = append(concerts, parsed)
+	}
+	sort.Slice(concerts, func(i, j int) bool { return concerts[i].Before(concerts[j]) })
+	return concerts, issues
+}
+
+// IssuesFor returns the issues recorded for one artist.
+func IssuesFor(data models.Datas, artistID int) []models.DataIssue {
+	var found []models.DataIssue
+	for _, is := range data.Issues {
+		if is.ArtistID == artistID {
+			found = append(found, is)
+		}
+	}
+	return found
+}
+
+func issue(artistID int, field, value string, err error) models.DataIssue {
+	return models.DataIssue{ArtistID: artistID, Field: field, Value: value, Message: err.Error()}
+}
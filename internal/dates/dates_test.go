@@ -0,0 +1,118 @@
+package dates
+
+import (
+	"testing"
+	"time"
+
+	"groupie-tracker/internal/models"
+)
+
+// TestParseConcert tests parsing upstream concert dates
+func TestParseConcert(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Time
+		valid    bool
+	}{
+		{"23-08-2019", time.Date(2019, 8, 23, 0, 0, 0, 0, time.UTC), true},
+		{"*23-08-2019", time.Date(2019, 8, 23, 0, 0, 0, 0, time.UTC), true},
+		{" 01-01-2020 ", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"2019-08-23", time.Time{}, false},
+		{"32-01-2020", time.Time{}, false},
+		{"", time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseConcert(tt.input)
+			if (err == nil) != tt.valid {
+				t.Fatalf("ParseConcert(%q) error = %v, want valid %v", tt.input, err, tt.valid)
+			}
+			if !got.Equal(tt.expected) {
+				t.Errorf("ParseConcert(%q) = %v, want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestParseFirstAlbum tests parsing first album dates
+func TestParseFirstAlbum(t *testing.T) {
+	tests := []struct {
+		input string
+		year  int
+		valid bool
+	}{
+		{"14-12-1973", 1973, true},
+		{"*14-12-1973", 0, false},
+		{"1973", 0, false},
+		{"14/12/1973", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseFirstAlbum(tt.input)
+			if (err == nil) != tt.valid {
+				t.Fatalf("ParseFirstAlbum(%q) error = %v, want valid %v", tt.input, err, tt.valid)
+			}
+			if tt.valid && got.Year() != tt.year {
+				t.Errorf("ParseFirstAlbum(%q).Year() = %d, want %d", tt.input, got.Year(), tt.year)
+			}
+		})
+	}
+}
+
+// TestAnnotate tests that parsed dates are stored and issues reported per artist
+func TestAnnotate(t *testing.T) {
+	data := models.Datas{
+		ArtistsData: []models.Artist{
+			{ID: 1, FirstAlbum: "14-12-1973"},
+			{ID: 2, FirstAlbum: "1973"},
+		},
+	}
+	data.DatesData.Index = append(data.DatesData.Index, struct {
+		ID    int      `json:"id"`
+		Dates []string `json:"dates"`
+	}{ID: 1, Dates: []string{"*23-08-2019", "bad", "20-08-2019"}})
+	data.RelationsData.Index = append(data.RelationsData.Index, struct {
+		ID             int                 `json:"id"`
+		DatesLocations map[string][]string `json:"datesLocations"`
+	}{ID: 2, DatesLocations: map[string][]string{"london-uk": {"2019", "02-01-2020", "01-01-2020"}}})
+
+	issues := Annotate(&data)
+
+	if data.ArtistsData[0].FirstAlbumDate.Year() != 1973 {
+		t.Errorf("FirstAlbumDate = %v, want 1973", data.ArtistsData[0].FirstAlbumDate)
+	}
+	if !data.ArtistsData[1].FirstAlbumDate.IsZero() {
+		t.Errorf("FirstAlbumDate = %v, want zero for invalid date", data.ArtistsData[1].FirstAlbumDate)
+	}
+
+	concerts := data.ConcertDates[1]
+	if len(concerts) != 2 || concerts[0].Day() != 20 || concerts[1].Day() != 23 {
+		t.Errorf("ConcertDates[1] = %v, want 20 and 23 August 2019", concerts)
+	}
+
+	london := data.RelationDates[2]["london-uk"]
+	if len(london) != 2 || london[0].Day() != 1 || london[1].Day() != 2 {
+		t.Errorf("RelationDates[2][london-uk] = %v, want 1 and 2 January 2020", london)
+	}
+
+	expected := []models.DataIssue{
+		{ArtistID: 1, Field: "concertDates", Value: "bad"},
+		{ArtistID: 2, Field: "firstAlbum", Value: "1973"},
+		{ArtistID: 2, Field: "relations.london-uk", Value: "2019"},
+	}
+	if len(issues) != len(expected) || len(data.Issues) != len(expected) {
+		t.Fatalf("Annotate() issues = %+v, want %d", issues, len(expected))
+	}
+	for i, want := range expected {
+		got := issues[i]
+		if got.ArtistID != want.ArtistID || got.Field != want.Field || got.Value != want.Value || got.Message == "" {
+			t.Errorf("issues[%d] = %+v, want %+v", i, got, want)
+		}
+	}
+
+	if got := IssuesFor(data, 2); len(got) != 2 {
+		t.Errorf("IssuesFor(2) = %+v, want 2 issues", got)
+	}
+}
@@ -0,0 +1,162 @@
+package geocoding
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// entry is a cached geocoding answer. NotFound entries record that the
+// provider had no result and expire after NegativeTTL.
+type entry struct {
+	Lat      float64   `json:"lat,omitempty"`
+	Lon      float64   `json:"lon,omitempty"`
+	NotFound bool      `json:"notFound,omitempty"`
+	CachedAt time.Time `json:"cachedAt"`
+}
+
+// cacheFile is the saved form of the cache. Provider names the geocoder
+// that gave the answers; files written before it was recorded hold the
+// entries map alone.
+type cacheFile struct {
+	Provider string           `json:"provider"`
+	Entries  map[string]entry `json:"entries"`
+}
+
+type cache struct {
+	path     string
+	provider string
+	entries  map[string]entry
+	dirty    bool
+	mutex    sync.RWMutex
+}
+
+func newCache(path, provider string) *cache {
+	return &cache{path: path, provider: provider, entries: make(map[string]entry)}
+}
+
+func (c *cache) get(key string) (entry, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	e, ok := c.entries[key]
+	if ok && e.NotFound && time.Since(e.CachedAt) > NegativeTTL {
+		return entry{}, false
+	}
+	return e, ok
+}
+
+func (c *cache) put(key string, e entry) {
+	e.CachedAt = time.Now()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries[key] = e
+	c.dirty = true
+}
+
+func (c *cache) len() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return len(c.entries)
+}
+
+// load reads previously saved entries. A missing file is not an error. A
+// file that cannot be decoded is moved aside to <path>.corrupt so the next
+// save does not overwrite the answers it may still hold; when it cannot be
+// read or moved, saving is disabled for this run instead. Entries saved
+// for another provider keep their coordinates, but their "no results
+// found" answers are dropped, as the current provider may know the place.
+func (c *cache) load() error {
+	if c.path == "" {
+		return nil
+	}
+
+	content, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		c.path = ""
+		return fmt.Errorf("failed to read geocoding cache, not saving it this run: %v", err)
+	}
+
+	var file cacheFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return c.setAside(fmt.Errorf("failed to decode geocoding cache %s: %v", c.path, err))
+	}
+	if file.Entries == nil {
+		if err := json.Unmarshal(content, &file.Entries); err != nil {
+			return c.setAside(fmt.Errorf("failed to decode geocoding cache %s: %v", c.path, err))
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries = file.Entries
+	if file.Provider != c.provider {
+		for key, e := range c.entries {
+			if e.NotFound {
+				delete(c.entries, key)
+			}
+		}
+		c.dirty = true
+	}
+	return nil
+}
+
+// setAside moves the unreadable cache file out of the way after err, or
+// disables saving if it cannot.
+func (c *cache) setAside(err error) error {
+	aside := c.path + ".corrupt"
+	if renameErr := os.Rename(c.path, aside); renameErr != nil {
+		c.path = ""
+		return fmt.Errorf("%v; not saving the geocoding cache this run: %v", err, renameErr)
+	}
+	return fmt.Errorf("%v; moved it to %s", err, aside)
+}
+
+// save atomically replaces the cache file with the current entries.
+func (c *cache) save() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.path == "" || !c.dirty {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(cacheFile{Provider: c.provider, Entries: c.entries}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode geocoding cache: %v", err)
+	}
+
+	dir := filepath.Dir(c.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create geocoding cache directory: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".geocode-*")
+	if err != nil {
+		return fmt.Errorf("failed to write geocoding cache: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write geocoding cache: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write geocoding cache: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("failed to replace geocoding cache: %v", err)
+	}
+
+	c.dirty = false
+	return nil
+}
@@ -0,0 +1,96 @@
+package geocoding
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"groupie-tracker/internal/models"
+	"groupie-tracker/internal/places"
+)
+
+// DefaultGazetteer is the bundled gazetteer file, relative to the
+// repository root.
+const DefaultGazetteer = "data/gazetteer.csv"
+
+// Gazetteer geocodes the dataset's "city-country" location strings from a
+// local table of places, without any network access.
+type Gazetteer struct {
+	places map[string]models.GeoLocation
+}
+
+// LoadGazetteer reads a gazetteer CSV file. See ParseGazetteer for the
+// expected format.
+func LoadGazetteer(path string) (*Gazetteer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gazetteer: %v", err)
+	}
+	defer f.Close()
+
+	g, err := ParseGazetteer(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load gazetteer %s: %v", path, err)
+	}
+	return g, nil
+}
+
+// ParseGazetteer reads CSV records of the form city,country,lat,lon. The
+// first record is a header and is skipped. Names are matched the way the
+// dataset spells them once normalised, so "Los Angeles,USA" resolves
+// "los_angeles-usa".
+func ParseGazetteer(r io.Reader) (*Gazetteer, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 4
+	reader.Comment = '#'
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) > 0 {
+		records = records[1:]
+	}
+
+	g := &Gazetteer{places: make(map[string]models.GeoLocation, len(records))}
+	for i, record := range records {
+		lat, err := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: invalid latitude %q", i+2, record[2])
+		}
+		lon, err := strconv.ParseFloat(strings.TrimSpace(record[3]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: invalid longitude %q", i+2, record[3])
+		}
+		g.places[gazetteerKey(record[0], record[1])] = models.GeoLocation{Lat: lat, Lon: lon}
+	}
+	return g, nil
+}
+
+// Name identifies gazetteer answers in the geocoding cache.
+func (g *Gazetteer) Name() string {
+	return "gazetteer"
+}
+
+func (g *Gazetteer) Geocode(_ context.Context, address string) (models.GeoLocation, error) {
+	place := places.Parse(address)
+	loc, ok := g.places[gazetteerKey(place.Name(), place.Country)]
+	if !ok {
+		return models.GeoLocation{}, fmt.Errorf("%w for address: %s", ErrNotFound, address)
+	}
+	loc.Address = address
+	return loc, nil
+}
+
+// Len reports how many places the gazetteer knows.
+func (g *Gazetteer) Len() int {
+	return len(g.places)
+}
+
+func gazetteerKey(city, country string) string {
+	return Normalize(city) + "|" + Normalize(country)
+}
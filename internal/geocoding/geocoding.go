@@ -0,0 +1,325 @@
+package geocoding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"groupie-tracker/internal/metrics"
+	"groupie-tracker/internal/models"
+	"groupie-tracker/internal/places"
+)
+
+// ErrNotFound is returned when the provider has no result for an address.
+// These answers are cached too, so the same address is not retried until
+// NegativeTTL has passed.
+var ErrNotFound = errors.New("no results found")
+
+// ErrClosed is returned by lookups that need the provider once the
+// Resolver has been closed.
+var ErrClosed = errors.New("geocoder closed")
+
+const (
+	// DefaultWorkers bounds the provider lookups LookupAll runs at once.
+	DefaultWorkers = 4
+
+	// NegativeTTL is how long a "no results found" answer is remembered.
+	NegativeTTL = 24 * time.Hour
+)
+
+// Geocoder resolves an address to coordinates. Implementations return an
+// error wrapping ErrNotFound when the address is unknown to them, and give
+// up when ctx is done.
+type Geocoder interface {
+	Geocode(ctx context.Context, address string) (models.GeoLocation, error)
+}
+
+// GeocoderFunc adapts an ordinary function to the Geocoder interface.
+type GeocoderFunc func(ctx context.Context, address string) (models.GeoLocation, error)
+
+func (f GeocoderFunc) Geocode(ctx context.Context, address string) (models.GeoLocation, error) {
+	return f(ctx, address)
+}
+
+// Named is implemented by providers that name themselves. The name is
+// saved with the cache, so answers from one provider are not mistaken for
+// another's.
+type Named interface {
+	Name() string
+}
+
+// providerName returns g's name, or "" if it has none.
+func providerName(g Geocoder) string {
+	if n, ok := g.(Named); ok {
+		return n.Name()
+	}
+	return ""
+}
+
+// Resolver geocodes addresses through a provider, caching the answers and
+// bounding how many lookups run at once. Each Resolver has its own cache.
+type Resolver struct {
+	geocoder Geocoder
+	store    *cache
+	// workers holds a slot for each provider lookup in flight, bounding
+	// them across every caller.
+	workers chan struct{}
+	logger  *slog.Logger
+	metrics *resolverMetrics
+
+	inflight   map[string]*call
+	inflightMu sync.Mutex
+	closed     bool
+
+	// pending counts the provider lookups in flight, which Close waits for.
+	pending sync.WaitGroup
+
+	// hits and misses count lookups answered without and with a provider
+	// request; lastErr is the provider's last failure other than
+	// ErrNotFound, guarded by inflightMu.
+	hits      atomic.Int64
+	misses    atomic.Int64
+	lastErr   error
+	lastErrAt time.Time
+}
+
+// Stats summarises a Resolver's cache and provider.
+type Stats struct {
+	Entries     int
+	Hits        int64
+	Misses      int64
+	LastError   error
+	LastErrorAt time.Time
+}
+
+// HitRate is the share of lookups answered without a provider request, or
+// zero before the first lookup.
+func (s Stats) HitRate() float64 {
+	if total := s.Hits + s.Misses; total > 0 {
+		return float64(s.Hits) / float64(total)
+	}
+	return 0
+}
+
+type call struct {
+	done chan struct{}
+	loc  models.GeoLocation
+	err  error
+
+	// abandoned reports that the caller making the provider request went
+	// away before it finished, so err says nothing about the address.
+	abandoned bool
+}
+
+// New returns a Resolver. g is the provider lookups go to (nil selects
+// Mapbox with no token), cachePath is the file results are persisted to
+// (empty keeps them in memory only) and maxWorkers bounds the provider
+// lookups in flight across all callers. The Resolver is usable even when
+// loading the cache file fails; it then starts empty.
+func New(g Geocoder, cachePath string, maxWorkers int) (*Resolver, error) {
+	if g == nil {
+		g = &Mapbox{}
+	}
+	if maxWorkers <= 0 {
+		maxWorkers = DefaultWorkers
+	}
+	r := &Resolver{
+		geocoder: g,
+		store:    newCache(cachePath, providerName(g)),
+		workers:  make(chan struct{}, maxWorkers),
+		logger:   slog.Default(),
+		metrics:  newResolverMetrics(metrics.NewRegistry()),
+		inflight: make(map[string]*call),
+	}
+	return r, r.store.load()
+}
+
+// SetLogger sets where failed lookups and cache writes are reported.
+func (r *Resolver) SetLogger(logger *slog.Logger) {
+	r.logger = logger
+}
+
+// Normalize returns the cache key for an address: lower case, with
+// underscores and repeated whitespace collapsed to single spaces.
+func Normalize(address string) string {
+	address = strings.ReplaceAll(strings.ToLower(address), "_", " ")
+	return strings.Join(strings.Fields(address), " ")
+}
+
+// Lookup geocodes a single address, answering from the cache when possible.
+// Concurrent lookups of the same address share one provider request, which
+// is logged with the request ID in ctx and cancelled when ctx is done; the
+// lookups sharing it then make their own.
+func (r *Resolver) Lookup(ctx context.Context, address string) (models.GeoLocation, error) {
+	key := Normalize(address)
+	if e, ok := r.store.get(key); ok {
+		r.hits.Add(1)
+		if e.NotFound {
+			return models.GeoLocation{}, fmt.Errorf("%w for address: %s", ErrNotFound, address)
+		}
+		return models.GeoLocation{Address: address, Lat: e.Lat, Lon: e.Lon}, nil
+	}
+
+	r.inflightMu.Lock()
+	if c, ok := r.inflight[key]; ok {
+		r.inflightMu.Unlock()
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return models.GeoLocation{}, ctx.Err()
+		}
+		if c.abandoned {
+			return r.Lookup(ctx, address)
+		}
+		r.hits.Add(1)
+		return withAddress(c.loc, address), c.err
+	}
+	if r.closed {
+		r.inflightMu.Unlock()
+		return models.GeoLocation{}, ErrClosed
+	}
+	if err := ctx.Err(); err != nil {
+		r.inflightMu.Unlock()
+		return models.GeoLocation{}, err
+	}
+	c := &call{done: make(chan struct{})}
+	r.inflight[key] = c
+	r.pending.Add(1)
+	r.inflightMu.Unlock()
+	defer r.pending.Done()
+	r.misses.Add(1)
+
+	select {
+	case r.workers <- struct{}{}:
+		start := time.Now()
+		c.loc, c.err = r.geocoder.Geocode(ctx, address)
+		<-r.workers
+		c.abandoned = c.err != nil && ctx.Err() != nil
+		r.metrics.observe(start, c.err, c.abandoned)
+		r.logRequest(ctx, address, time.Since(start), c.err, c.abandoned)
+	case <-ctx.Done():
+		// Gave up waiting for a worker; no provider request was made
+		c.err, c.abandoned = ctx.Err(), true
+	}
+	switch {
+	case c.err == nil:
+		r.store.put(key, entry{Lat: c.loc.Lat, Lon: c.loc.Lon})
+	case errors.Is(c.err, ErrNotFound):
+		r.store.put(key, entry{NotFound: true})
+	}
+
+	r.inflightMu.Lock()
+	if c.err != nil && !c.abandoned && !errors.Is(c.err, ErrNotFound) {
+		r.lastErr, r.lastErrAt = c.err, time.Now()
+	}
+	delete(r.inflight, key)
+	r.inflightMu.Unlock()
+	close(c.done)
+
+	return withAddress(c.loc, address), c.err
+}
+
+// LookupAll geocodes addresses concurrently, within the Resolver's bound on
+// provider lookups in flight. Results keep the input order and carry the
+// place's display name; addresses that cannot be geocoded are logged and
+// left out. Once ctx is done no more lookups start and those in flight are
+// cancelled, leaving the results incomplete. New results are persisted
+// before it returns.
+func (r *Resolver) LookupAll(ctx context.Context, addresses []string) []models.GeoLocation {
+	results := make([]models.GeoLocation, len(addresses))
+	ok := make([]bool, len(addresses))
+
+	var wg sync.WaitGroup
+	for i, address := range addresses {
+		wg.Add(1)
+		go func(i int, address string) {
+			defer wg.Done()
+
+			loc, err := r.Lookup(ctx, address)
+			if err != nil {
+				if ctx.Err() == nil {
+					r.logger.WarnContext(ctx, "Failed to geocode location", "address", address, "error", err)
+				}
+				return
+			}
+			loc.Name = places.Parse(address).String()
+			results[i], ok[i] = loc, true
+		}(i, address)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		r.logger.InfoContext(ctx, "Geocoding stopped early", "addresses", len(addresses), "reason", err)
+	}
+
+	if err := r.Save(); err != nil {
+		r.logger.ErrorContext(ctx, "Failed to save geocoding cache", "error", err)
+	}
+
+	var geoLocations []models.GeoLocation
+	for i, loc := range results {
+		if ok[i] {
+			geoLocations = append(geoLocations, loc)
+		}
+	}
+	return geoLocations
+}
+
+// logRequest logs one provider request, so slow pages can be traced to the
+// lookups they waited on.
+func (r *Resolver) logRequest(ctx context.Context, address string, took time.Duration, err error, abandoned bool) {
+	switch {
+	case abandoned:
+		r.logger.InfoContext(ctx, "Geocoding request abandoned", "address", address, "duration", took, "reason", ctx.Err())
+	case err == nil:
+		r.logger.InfoContext(ctx, "Geocoded location", "address", address, "duration", took)
+	case errors.Is(err, ErrNotFound):
+		r.logger.InfoContext(ctx, "Location not found by geocoder", "address", address, "duration", took)
+	default:
+		r.logger.WarnContext(ctx, "Geocoding request failed", "address", address, "duration", took, "error", err)
+	}
+}
+
+// Stats reports the cache size, how many lookups it answered and the
+// provider's last failure. Lookups sharing another's provider request
+// count as hits.
+func (r *Resolver) Stats() Stats {
+	r.inflightMu.Lock()
+	lastErr, lastErrAt := r.lastErr, r.lastErrAt
+	r.inflightMu.Unlock()
+
+	return Stats{
+		Entries:     r.store.len(),
+		Hits:        r.hits.Load(),
+		Misses:      r.misses.Load(),
+		LastError:   lastErr,
+		LastErrorAt: lastErrAt,
+	}
+}
+
+// Close stops new provider lookups, waits for those in flight and saves the
+// cache. Cached answers are still served afterwards.
+func (r *Resolver) Close() error {
+	r.inflightMu.Lock()
+	r.closed = true
+	r.inflightMu.Unlock()
+
+	r.pending.Wait()
+	return r.Save()
+}
+
+// Save writes the cache to disk if it has changed since it was last saved.
+func (r *Resolver) Save() error {
+	return r.store.save()
+}
+
+func withAddress(loc models.GeoLocation, address string) models.GeoLocation {
+	if loc.Address != "" {
+		loc.Address = address
+	}
+	return loc
+}
@@ -0,0 +1,591 @@
+package geocoding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"groupie-tracker/internal/logging"
+	"groupie-tracker/internal/metrics"
+	"groupie-tracker/internal/models"
+)
+
+// fakeProvider counts lookups and tracks how many run at once.
+type fakeProvider struct {
+	mu      sync.Mutex
+	calls   map[string]int
+	active  int
+	maxSeen int
+}
+
+func (f *fakeProvider) lookup(_ context.Context, address string) (models.GeoLocation, error) {
+	f.mu.Lock()
+	f.calls[Normalize(address)]++
+	f.active++
+	if f.active > f.maxSeen {
+		f.maxSeen = f.active
+	}
+	f.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	f.mu.Lock()
+	f.active--
+	f.mu.Unlock()
+
+	if Normalize(address) == "atlantis-ocean" {
+		return models.GeoLocation{}, fmt.Errorf("%w for address: %s", ErrNotFound, address)
+	}
+	return models.GeoLocation{Address: address, Lat: 1, Lon: 2}, nil
+}
+
+func useFake(t *testing.T, cachePath string, maxWorkers int) (*Resolver, *fakeProvider) {
+	t.Helper()
+	f := &fakeProvider{calls: make(map[string]int)}
+	r, err := New(GeocoderFunc(f.lookup), cachePath, maxWorkers)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return r, f
+}
+
+// TestNormalize tests cache key normalisation
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		address  string
+		expected string
+	}{
+		{"los_angeles-usa", "los angeles-usa"},
+		{"  Los  Angeles-USA ", "los angeles-usa"},
+		{"north_carolina-usa", "north carolina-usa"},
+	}
+
+	for _, tt := range tests {
+		if got := Normalize(tt.address); got != tt.expected {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.address, got, tt.expected)
+		}
+	}
+}
+
+// TestLookupCaches tests that repeated and equivalent addresses hit the cache
+func TestLookupCaches(t *testing.T) {
+	r, f := useFake(t, "", 2)
+
+	for _, address := range []string{"los_angeles-usa", "Los Angeles-USA", "los_angeles-usa"} {
+		loc, err := r.Lookup(context.Background(), address)
+		if err != nil {
+			t.Fatalf("Lookup(%q) error = %v", address, err)
+		}
+		if loc.Address != address || loc.Lat != 1 || loc.Lon != 2 {
+			t.Errorf("Lookup(%q) = %+v, want lat 1 lon 2 for %[1]q", address, loc)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := r.Lookup(context.Background(), "atlantis-ocean"); err == nil {
+			t.Error("Lookup(atlantis-ocean) error = nil, want ErrNotFound")
+		}
+	}
+
+	if got := f.calls["los angeles-usa"]; got != 1 {
+		t.Errorf("provider calls for los angeles-usa = %d, want 1", got)
+	}
+	if got := f.calls["atlantis-ocean"]; got != 1 {
+		t.Errorf("provider calls for atlantis-ocean = %d, want 1 (negative cache)", got)
+	}
+}
+
+// TestLookupAll tests ordering, failure skipping and that concurrency is
+// bounded across calls
+func TestLookupAll(t *testing.T) {
+	r, f := useFake(t, "", 2)
+
+	addresses := []string{"a-x", "b-x", "atlantis-ocean", "c-x", "d-x", "e-x", "a-x"}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.LookupAll(context.Background(), []string{"f-x", "g-x", "h-x", "i-x"})
+	}()
+	got := r.LookupAll(context.Background(), addresses)
+	<-done
+
+	want := []string{"a-x", "b-x", "c-x", "d-x", "e-x", "a-x"}
+	if len(got) != len(want) {
+		t.Fatalf("LookupAll() = %d locations, want %d", len(got), len(want))
+	}
+	for i, loc := range got {
+		if loc.Address != want[i] {
+			t.Errorf("LookupAll()[%d].Address = %q, want %q", i, loc.Address, want[i])
+		}
+	}
+	if f.maxSeen > 2 {
+		t.Errorf("concurrent lookups = %d, want at most 2", f.maxSeen)
+	}
+}
+
+// TestCachePersistence tests that results survive a restart
+func TestCachePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geocode.json")
+
+	r, _ := useFake(t, path, 2)
+	r.LookupAll(context.Background(), []string{"london-uk", "atlantis-ocean"})
+
+	r, f := useFake(t, path, 2)
+	if _, err := r.Lookup(context.Background(), "london-uk"); err != nil {
+		t.Fatalf("Lookup(london-uk) error = %v", err)
+	}
+	if _, err := r.Lookup(context.Background(), "atlantis-ocean"); err == nil {
+		t.Error("Lookup(atlantis-ocean) error = nil, want cached ErrNotFound")
+	}
+	if len(f.calls) != 0 {
+		t.Errorf("provider calls after reload = %v, want none", f.calls)
+	}
+}
+
+// namedProvider gives a fake provider a name.
+type namedProvider struct {
+	Geocoder
+	name string
+}
+
+func (n namedProvider) Name() string { return n.name }
+
+// TestCacheProvider tests that the cache file records its provider and that
+// "no results found" answers are forgotten when the provider changes
+func TestCacheProvider(t *testing.T) {
+	useNamed := func(path, name string) (*Resolver, *fakeProvider) {
+		f := &fakeProvider{calls: make(map[string]int)}
+		r, err := New(namedProvider{GeocoderFunc(f.lookup), name}, path, 1)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		return r, f
+	}
+	addresses := []string{"london-uk", "atlantis-ocean"}
+
+	t.Run("Provider changed", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "geocode.json")
+		r, _ := useNamed(path, "mapbox")
+		r.LookupAll(context.Background(), addresses)
+		r.Close()
+
+		r, f := useNamed(path, "mapbox")
+		r.LookupAll(context.Background(), addresses)
+		if len(f.calls) != 0 {
+			t.Errorf("provider calls with the same provider = %v, want none", f.calls)
+		}
+
+		r, f = useNamed(path, "gazetteer")
+		r.LookupAll(context.Background(), addresses)
+		r.Close()
+		if f.calls["london-uk"] != 0 || f.calls["atlantis-ocean"] != 1 {
+			t.Errorf("provider calls after a provider change = %v, want only atlantis-ocean", f.calls)
+		}
+
+		var file cacheFile
+		content, _ := os.ReadFile(path)
+		if err := json.Unmarshal(content, &file); err != nil || file.Provider != "gazetteer" {
+			t.Errorf("cache file = %s, want it saved for gazetteer", content)
+		}
+	})
+
+	t.Run("Unnamed file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "geocode.json")
+		legacy := map[string]entry{
+			"london-uk":      {Lat: 1, Lon: 2, CachedAt: time.Now()},
+			"atlantis-ocean": {NotFound: true, CachedAt: time.Now()},
+		}
+		content, _ := json.Marshal(legacy)
+		os.WriteFile(path, content, 0o644)
+
+		r, f := useNamed(path, "mapbox")
+		r.LookupAll(context.Background(), addresses)
+		if f.calls["london-uk"] != 0 || f.calls["atlantis-ocean"] != 1 {
+			t.Errorf("provider calls after loading an unnamed file = %v, want only atlantis-ocean", f.calls)
+		}
+	})
+}
+
+// TestCorruptCache tests that an unreadable cache file is kept rather than
+// overwritten by the next save
+func TestCorruptCache(t *testing.T) {
+	garbage := []byte("{not json")
+
+	t.Run("Moved aside", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "geocode.json")
+		os.WriteFile(path, garbage, 0o644)
+
+		f := &fakeProvider{calls: make(map[string]int)}
+		r, err := New(GeocoderFunc(f.lookup), path, 1)
+		if err == nil || !strings.Contains(err.Error(), path+".corrupt") {
+			t.Errorf("New() error = %v, want it to name %s.corrupt", err, path)
+		}
+		r.LookupAll(context.Background(), []string{"london-uk"})
+		if err := r.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+
+		if content, _ := os.ReadFile(path + ".corrupt"); string(content) != string(garbage) {
+			t.Errorf("%s.corrupt = %q, want the unreadable file", path, content)
+		}
+		r, f = useFake(t, path, 1)
+		r.Lookup(context.Background(), "london-uk")
+		if f.calls["london-uk"] != 0 {
+			t.Errorf("london-uk looked up again after a restart, want it read from the new cache file")
+		}
+	})
+
+	t.Run("Cannot move", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "geocode.json")
+		os.WriteFile(path, garbage, 0o644)
+		os.MkdirAll(filepath.Join(path+".corrupt", "taken"), 0o755)
+
+		f := &fakeProvider{calls: make(map[string]int)}
+		r, err := New(GeocoderFunc(f.lookup), path, 1)
+		if err == nil || !strings.Contains(err.Error(), "not saving") {
+			t.Errorf("New() error = %v, want saving disabled", err)
+		}
+		r.LookupAll(context.Background(), []string{"london-uk"})
+		if err := r.Close(); err != nil {
+			t.Errorf("Close() error = %v", err)
+		}
+
+		if content, _ := os.ReadFile(path); string(content) != string(garbage) {
+			t.Errorf("%s = %q, want the unreadable file left alone", path, content)
+		}
+	})
+}
+
+// TestGazetteer tests offline geocoding of dataset location strings
+func TestGazetteer(t *testing.T) {
+	g, err := ParseGazetteer(strings.NewReader(`city,country,lat,lon
+# comments are ignored
+Los Angeles,USA,34.0522,-118.2437
+North Carolina,USA,35.7596,-79.0193
+Penrose,New Zealand,-36.9167,174.8167
+`))
+	if err != nil {
+		t.Fatalf("ParseGazetteer() error = %v", err)
+	}
+
+	tests := []struct {
+		address string
+		lat     float64
+		lon     float64
+		found   bool
+	}{
+		{"los_angeles-usa", 34.0522, -118.2437, true},
+		{"north_carolina-usa", 35.7596, -79.0193, true},
+		{"penrose-new_zealand", -36.9167, 174.8167, true},
+		{"los_angeles-mexico", 0, 0, false},
+		{"atlantis", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			loc, err := g.Geocode(context.Background(), tt.address)
+			if !tt.found {
+				if !errors.Is(err, ErrNotFound) {
+					t.Errorf("Geocode(%q) error = %v, want ErrNotFound", tt.address, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Geocode(%q) error = %v", tt.address, err)
+			}
+			if loc.Address != tt.address || loc.Lat != tt.lat || loc.Lon != tt.lon {
+				t.Errorf("Geocode(%q) = %+v", tt.address, loc)
+			}
+		})
+	}
+}
+
+// TestBundledGazetteer tests that the bundled gazetteer loads and covers the
+// handler fixtures
+func TestBundledGazetteer(t *testing.T) {
+	g, err := LoadGazetteer(filepath.Join("..", "..", DefaultGazetteer))
+	if err != nil {
+		t.Fatalf("LoadGazetteer() error = %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join("..", "handlers", "testdata", "locations.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var locations models.Location
+	if err := json.Unmarshal(content, &locations); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, index := range locations.Index {
+		for _, address := range index.Locations {
+			if _, err := g.Geocode(context.Background(), address); err != nil {
+				t.Errorf("Geocode(%q) error = %v", address, err)
+			}
+		}
+	}
+}
+
+// TestMapbox tests the Mapbox geocoder against a fake API
+func TestMapbox(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("access_token") != "token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/Los Angeles, USA.json" {
+			w.Write([]byte(`{"features": []}`))
+			return
+		}
+		w.Write([]byte(`{"features": [{"center": [-118.24, 34.05]}]}`))
+	}))
+	defer srv.Close()
+
+	m := NewMapbox(srv.URL, "token")
+	loc, err := m.Geocode(context.Background(), "los_angeles-usa")
+	if err != nil {
+		t.Fatalf("Geocode() error = %v", err)
+	}
+	if loc.Lat != 34.05 || loc.Lon != -118.24 {
+		t.Errorf("Geocode() = %+v, want lat 34.05 lon -118.24", loc)
+	}
+
+	if _, err := m.Geocode(context.Background(), "atlantis"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Geocode(atlantis) error = %v, want ErrNotFound", err)
+	}
+
+	m.AccessToken = "wrong"
+	if _, err := m.Geocode(context.Background(), "los_angeles-usa"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Geocode() with bad token error = %v, want a provider error", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.Geocode(ctx, "los_angeles-usa"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Geocode() with a cancelled context error = %v, want context.Canceled", err)
+	}
+}
+
+// TestMapboxErrorsHideToken tests that failed Mapbox requests are logged
+// without the access token in their URL
+func TestMapboxErrorsHideToken(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	var buf bytes.Buffer
+	r, err := New(NewMapbox(srv.URL, "sk.SECRET"), "", 1)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	r.SetLogger(logging.New(&buf))
+	r.LookupAll(context.Background(), []string{"paris-france"})
+
+	if !strings.Contains(buf.String(), "Geocoding request failed") {
+		t.Fatalf("log = %s, want the failed request logged", buf.String())
+	}
+	if strings.Contains(buf.String(), "sk.SECRET") {
+		t.Errorf("log = %s, exposes the access token", buf.String())
+	}
+	if err := r.Stats().LastError; err == nil || strings.Contains(err.Error(), "sk.SECRET") {
+		t.Errorf("Stats().LastError = %v, want the failure without the access token", err)
+	}
+}
+
+// TestClose tests that Close waits for lookups in flight and stops new
+// provider lookups while cached answers keep being served
+func TestClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geocode.json")
+	r, f := useFake(t, path, 2)
+
+	started := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		close(started)
+		_, err := r.Lookup(context.Background(), "london-uk")
+		done <- err
+	}()
+	<-started
+	time.Sleep(time.Millisecond)
+
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := <-done; err != nil && !errors.Is(err, ErrClosed) {
+		t.Errorf("Lookup(london-uk) during Close error = %v", err)
+	}
+
+	if _, err := r.Lookup(context.Background(), "paris-france"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Lookup(paris-france) after Close error = %v, want ErrClosed", err)
+	}
+	if f.calls["london-uk"] == 1 {
+		if _, err := r.Lookup(context.Background(), "london-uk"); err != nil {
+			t.Errorf("Lookup(london-uk) after Close error = %v, want the cached answer", err)
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("cache file after Close: %v, want it saved", err)
+		}
+	}
+}
+
+// TestStats tests hit and miss counting and the provider's last failure
+func TestStats(t *testing.T) {
+	failing := true
+	r, err := New(GeocoderFunc(func(_ context.Context, address string) (models.GeoLocation, error) {
+		if failing {
+			return models.GeoLocation{}, errors.New("provider unreachable")
+		}
+		return models.GeoLocation{Address: address, Lat: 1, Lon: 2}, nil
+	}), "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rate := r.Stats().HitRate(); rate != 0 {
+		t.Errorf("HitRate() before any lookup = %v, want 0", rate)
+	}
+
+	r.Lookup(context.Background(), "london-uk")
+	failing = false
+	for i := 0; i < 4; i++ {
+		r.Lookup(context.Background(), "london-uk")
+	}
+
+	stats := r.Stats()
+	if stats.Entries != 1 || stats.Hits != 3 || stats.Misses != 2 {
+		t.Errorf("Stats() = %+v, want 1 entry, 3 hits and 2 misses", stats)
+	}
+	if stats.HitRate() != 0.6 {
+		t.Errorf("HitRate() = %v, want 0.6", stats.HitRate())
+	}
+	if stats.LastError == nil || stats.LastErrorAt.IsZero() {
+		t.Errorf("Stats() = %+v, want the provider failure recorded", stats)
+	}
+}
+
+// TestMetrics tests that provider requests are counted by result
+func TestMetrics(t *testing.T) {
+	r, _ := useFake(t, "", 1)
+	reg := metrics.NewRegistry()
+	r.SetMetrics(reg)
+
+	r.Lookup(context.Background(), "london-uk")
+	r.Lookup(context.Background(), "london-uk")
+	r.Lookup(context.Background(), "atlantis-ocean")
+
+	var b strings.Builder
+	reg.WriteTo(&b)
+	for _, expected := range []string{
+		`groupie_geocode_requests_total{result="not_found"} 1`,
+		`groupie_geocode_requests_total{result="ok"} 1`,
+		"groupie_geocode_request_duration_seconds_count 2",
+		"groupie_geocode_cache_entries 2",
+		"groupie_geocode_cache_hits_total 1",
+		"groupie_geocode_cache_misses_total 2",
+	} {
+		if !strings.Contains(b.String(), expected) {
+			t.Errorf("metrics = %s\nwant them to contain %q", b.String(), expected)
+		}
+	}
+}
+
+// slowProvider answers after delay unless the lookup's context is done
+// first, counting the lookups started.
+type slowProvider struct {
+	delay time.Duration
+	mu    sync.Mutex
+	calls int
+}
+
+func (p *slowProvider) lookup(ctx context.Context, address string) (models.GeoLocation, error) {
+	p.mu.Lock()
+	p.calls++
+	p.mu.Unlock()
+	select {
+	case <-time.After(p.delay):
+		return models.GeoLocation{Address: address, Lat: 1, Lon: 2}, nil
+	case <-ctx.Done():
+		return models.GeoLocation{}, ctx.Err()
+	}
+}
+
+func (p *slowProvider) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
+
+// TestLookupAllCancel tests that an abandoned LookupAll stops its provider
+// requests, starts no more and caches nothing
+func TestLookupAllCancel(t *testing.T) {
+	p := &slowProvider{delay: time.Second}
+	r, err := New(GeocoderFunc(p.lookup), "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := metrics.NewRegistry()
+	r.SetMetrics(reg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	locations := r.LookupAll(ctx, []string{"london-uk", "paris-france", "berlin-germany", "rome-italy"})
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("LookupAll() took %s after its context was done", elapsed)
+	}
+	if len(locations) != 0 {
+		t.Errorf("LookupAll() = %v, want nothing", locations)
+	}
+	if p.count() != 2 {
+		t.Errorf("provider lookups = %d, want only the 2 started before the context was done", p.count())
+	}
+	stats := r.Stats()
+	if stats.Entries != 0 || stats.LastError != nil {
+		t.Errorf("Stats() = %+v, want nothing cached and no provider failure", stats)
+	}
+
+	var b strings.Builder
+	reg.WriteTo(&b)
+	if expected := `groupie_geocode_requests_total{result="canceled"} 2`; !strings.Contains(b.String(), expected) {
+		t.Errorf("metrics = %s\nwant them to contain %q", b.String(), expected)
+	}
+}
+
+// TestLookupSharedCancel tests that a lookup sharing an abandoned provider
+// request makes its own instead of failing
+func TestLookupSharedCancel(t *testing.T) {
+	p := &slowProvider{delay: 50 * time.Millisecond}
+	r, err := New(GeocoderFunc(p.lookup), "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	abandoned, cancel := context.WithCancel(context.Background())
+	go r.Lookup(abandoned, "london-uk")
+	time.Sleep(10 * time.Millisecond)
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := r.Lookup(context.Background(), "london-uk")
+		result <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	if err := <-result; err != nil {
+		t.Errorf("Lookup() error = %v, want it to geocode on its own", err)
+	}
+	if p.count() != 2 {
+		t.Errorf("provider lookups = %d, want 2", p.count())
+	}
+}
@@ -0,0 +1,94 @@
+package geocoding
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"groupie-tracker/internal/models"
+	"groupie-tracker/internal/places"
+	"groupie-tracker/internal/service"
+)
+
+// Mapbox geocodes addresses with the Mapbox forward geocoding API. An empty
+// APIURL falls back to the public endpoint and a nil Client to the default
+// HTTP client, which has no timeout; the access token has no fallback.
+type Mapbox struct {
+	APIURL      string
+	AccessToken string
+	Client      *http.Client
+}
+
+// NewMapbox returns a Mapbox geocoder for the given API URL and token.
+func NewMapbox(apiURL, accessToken string) *Mapbox {
+	return &Mapbox{APIURL: apiURL, AccessToken: accessToken, Client: http.DefaultClient}
+}
+
+// Name identifies Mapbox answers in the geocoding cache.
+func (m *Mapbox) Name() string {
+	return "mapbox"
+}
+
+func (m *Mapbox) Geocode(ctx context.Context, address string) (models.GeoLocation, error) {
+	mapboxGeocodingAPI := m.APIURL
+	if mapboxGeocodingAPI == "" {
+		mapboxGeocodingAPI = service.GetMapboxGeocodingAPI()
+	}
+	mapboxAccessToken := m.AccessToken
+	client := m.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	// Mapbox resolves "Los Angeles, USA" far more reliably than the raw
+	// "los_angeles-usa" spelling.
+	query := places.Parse(address).String()
+	endpoint := fmt.Sprintf("%s/%s.json?access_token=%s", mapboxGeocodingAPI, url.PathEscape(query), mapboxAccessToken)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return models.GeoLocation{}, fmt.Errorf("geocoding %s: %w", address, withoutURL(err))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return models.GeoLocation{}, fmt.Errorf("geocoding %s: %w", address, withoutURL(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return models.GeoLocation{}, fmt.Errorf("geocoding %s: unexpected status %s", address, resp.Status)
+	}
+
+	var result struct {
+		Features []struct {
+			Center [2]float64 `json:"center"`
+		} `json:"features"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return models.GeoLocation{}, err
+	}
+
+	if len(result.Features) == 0 {
+		return models.GeoLocation{}, fmt.Errorf("%w for address: %s", ErrNotFound, address)
+	}
+
+	return models.GeoLocation{
+		Address: address,
+		Lon:     result.Features[0].Center[0],
+		Lat:     result.Features[0].Center[1],
+	}, nil
+}
+
+// withoutURL drops the request URL, which carries the access token, from
+// errors that quote it, so they can be logged and reported safely.
+func withoutURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+package geocoding
+
+import (
+	"errors"
+	"time"
+
+	"groupie-tracker/internal/metrics"
+)
+
+// resolverMetrics times the provider requests a Resolver makes and counts
+// how they went.
+type resolverMetrics struct {
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+}
+
+func newResolverMetrics(reg *metrics.Registry) *resolverMetrics {
+	return &resolverMetrics{
+		requests: reg.Counter("groupie_geocode_requests_total",
+			"Geocoding provider requests, by result: ok, not_found, error or canceled (the caller went away).",
+			"result"),
+		duration: reg.Histogram("groupie_geocode_request_duration_seconds",
+			"Time taken by geocoding provider requests.",
+			metrics.DefaultBuckets),
+	}
+}
+
+// SetMetrics publishes provider request counts and timings on reg, plus the
+// size, hits and misses of the Resolver's cache. A Resolver built by New
+// records into a private registry until then.
+func (r *Resolver) SetMetrics(reg *metrics.Registry) {
+	r.metrics = newResolverMetrics(reg)
+	reg.GaugeFunc("groupie_geocode_cache_entries",
+		"Addresses in the geocoding cache, including those not found.",
+		func() float64 { return float64(r.store.len()) })
+	reg.CounterFunc("groupie_geocode_cache_hits_total",
+		"Lookups answered without a provider request.",
+		func() float64 { return float64(r.hits.Load()) })
+	reg.CounterFunc("groupie_geocode_cache_misses_total",
+		"Lookups that needed a provider request.",
+		func() float64 { return float64(r.misses.Load()) })
+}
+
+// observe records one provider request that started at start.
+func (m *resolverMetrics) observe(start time.Time, err error, abandoned bool) {
+	m.duration.With().Observe(time.Since(start).Seconds())
+	result := "ok"
+	switch {
+	case abandoned:
+		result = "canceled"
+	case errors.Is(err, ErrNotFound):
+		result = "not_found"
+	case err != nil:
+		result = "error"
+	}
+	m.requests.With(result).Inc()
+}
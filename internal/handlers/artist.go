@@ -1,19 +1,19 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
-	"log"
 	"net/http"
-	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
-	"groupie-tracker/internal/cache"
+	"groupie-tracker/internal/dates"
 	"groupie-tracker/internal/models"
+	"groupie-tracker/internal/timeline"
 )
 
-func HandleArtist(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) HandleArtist(w http.ResponseWriter, r *http.Request) {
 	idStr := strings.TrimPrefix(r.URL.Path, "/api/artist/")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -21,11 +21,22 @@ func HandleArtist(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cachedData, err := cache.GetCachedData()
+	// Optional ?now=YYYY-MM-DD overrides the reference time for this request
+	reference := h.now()
+	if nowParam := r.URL.Query().Get("now"); nowParam != "" {
+		reference, err = time.Parse("2006-01-02", nowParam)
+		if err != nil {
+			ErrorHandler(w, r, http.StatusBadRequest, "Invalid now parameter, want YYYY-MM-DD")
+			return
+		}
+	}
+
+	cachedData, err := h.cache.GetCachedData(r.Context())
 	if err != nil {
 		ErrorHandler(w, r, http.StatusInternalServerError, "Failed to fetch data")
 		return
 	}
+	h.setDataAge(w)
 
 	var artist models.Artist
 	for _, a := range cachedData.ArtistsData {
@@ -42,27 +53,31 @@ func HandleArtist(w http.ResponseWriter, r *http.Request) {
 
 	details := models.ArtistDetail{
 		Artist:    artist,
-		Locations: getLocations(id, cachedData.LocationsData),
+		Locations: h.getLocations(r.Context(), id, cachedData.LocationsData),
 		Dates:     getDates(id, cachedData.DatesData),
 		Relations: getRelations(id, cachedData.RelationsData),
+		Events:    timeline.Build(cachedData.RelationDates[id], reference),
+		Issues:    dates.IssuesFor(cachedData, id),
+	}
+	if r.Context().Err() != nil {
+		// The client went away and its geocoding was cut short
+		return
 	}
 
 	json.NewEncoder(w).Encode(details)
 }
 
-func getLocations(id int, locationsData models.Location) []models.GeoLocation {
+// setDataAge reports how old the cached data behind a response is, in
+// seconds, through the standard Age header.
+func (h *Handlers) setDataAge(w http.ResponseWriter) {
+	age := int(h.cache.Age() / time.Second)
+	w.Header().Set("Age", strconv.Itoa(age))
+}
+
+func (h *Handlers) getLocations(ctx context.Context, id int, locationsData models.Location) []models.GeoLocation {
 	for _, loc := range locationsData.Index {
 		if loc.ID == id {
-			var geoLocations []models.GeoLocation
-			for _, location := range loc.Locations {
-				geoLoc, err := geocode(location)
-				if err != nil {
-					log.Printf("Failed to geocode location: %v", err)
-					continue
-				}
-				geoLocations = append(geoLocations, geoLoc)
-			}
-			return geoLocations
+			return h.geocoder.LookupAll(ctx, loc.Locations)
 		}
 	}
 	return nil
@@ -85,36 +100,3 @@ func getRelations(id int, relationsData models.Relation) map[string][]string {
 	}
 	return nil
 }
-
-func geocode(address string) (models.GeoLocation, error) {
-	mapboxGeocodingAPI := models.GetMapboxGeocodingAPI()
-	mapboxAccessToken := models.GetMapboxAccessToken()
-	
-	url := fmt.Sprintf("%s/%s.json?access_token=%s", mapboxGeocodingAPI, url.QueryEscape(address), mapboxAccessToken)
-
-	resp, err := http.Get(url)
-	if err != nil {
-		return models.GeoLocation{}, err
-	}
-	defer resp.Body.Close()
-
-	var result struct {
-		Features []struct {
-			Center [2]float64 `json:"center"`
-		} `json:"features"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return models.GeoLocation{}, err
-	}
-
-	if len(result.Features) == 0 {
-		return models.GeoLocation{}, fmt.Errorf("no results found for address: %s", address)
-	}
-
-	return models.GeoLocation{
-		Address: address,
-		Lon:     result.Features[0].Center[0],
-		Lat:     result.Features[0].Center[1],
-	}, nil
-}
\ No newline at end of file
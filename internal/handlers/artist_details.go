@@ -4,23 +4,31 @@ import (
     "html/template"
     "net/http"
     "strings"
+
+    "groupie-tracker/internal/models"
 )
 
-func HandleArtistDetails(tpl *template.Template) http.HandlerFunc {
+// HandleArtistDetails renders an artist's page with the browser
+// configuration; the page's script loads the artist itself.
+func (h *Handlers) HandleArtistDetails(tpl *template.Template) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         path := r.URL.Path
-        artistID := strings.TrimPrefix(path, "/artist/")
-
-        if artistID == "" {
-            ErrorHandler(w, r, http.StatusBadRequest, "Missing artist ID")
+        if !strings.HasPrefix(path, "/artist/") {
+            http.Error(w, "Invalid artist ID", http.StatusBadRequest)
             return
         }
 
+        // An empty ID still renders the page, which reports the missing
+        // artist once its script asks the API for it
+        artistID := strings.TrimPrefix(path, "/artist/")
+
         // Create template data with artist ID
         data := struct {
             ArtistID string
+            Config   models.ClientConfig
         }{
             ArtistID: artistID,
+            Config:   h.clientConfig,
         }
 
         // Render the template
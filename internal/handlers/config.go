@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+
+	"groupie-tracker/internal/models"
+)
+
+// HandleConfig serves the browser configuration as JSON.
+func (h *Handlers) HandleConfig(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(h.clientConfig)
+}
+
+// HandleIndex renders the search page with the browser configuration.
+// Any path other than the root is not found.
+func (h *Handlers) HandleIndex(tpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			ErrorHandler(w, r, http.StatusNotFound, "Page Not Found")
+			return
+		}
+
+		data := struct {
+			Config models.ClientConfig
+		}{
+			Config: h.clientConfig,
+		}
+		if err := tpl.Execute(w, data); err != nil {
+			ErrorHandler(w, r, http.StatusInternalServerError, "Failed to render template")
+		}
+	}
+}
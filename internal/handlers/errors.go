@@ -1,11 +1,39 @@
 package handlers
 
 import (
-	"net/http"
+	"encoding/json"
 	"html/template"
+	"net/http"
+	"strings"
+
+	"groupie-tracker/internal/logging"
+	"groupie-tracker/internal/models"
 )
 
+// ErrorHandler reports an error to the client: as a models.APIError JSON
+// body for API routes and clients that accept JSON, otherwise as the error
+// page.
 func ErrorHandler(w http.ResponseWriter, r *http.Request, statusCode int, message string) {
+	errorWithDetails(w, r, statusCode, message, nil)
+}
+
+// errorWithDetails is ErrorHandler with machine-readable details for JSON
+// clients, such as where a query failed to parse.
+func errorWithDetails(w http.ResponseWriter, r *http.Request, statusCode int, message string, details interface{}) {
+	if wantsJSON(r) {
+		id := requestID(w, r)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(models.APIError{
+			Code:      errorCode(statusCode),
+			Message:   message,
+			Details:   details,
+			RequestID: id,
+		})
+		return
+	}
+
 	// Parse the HTML template from a file
 	tmplPath := "templates/error.html"
 	tmpl, err := template.ParseFiles(tmplPath)
@@ -27,3 +55,36 @@ func ErrorHandler(w http.ResponseWriter, r *http.Request, statusCode int, messag
 	w.WriteHeader(statusCode)
 	tmpl.Execute(w, data)
 }
+
+// wantsJSON reports whether an error should be reported as JSON: always on
+// API routes, and elsewhere when the client asks for JSON
+func wantsJSON(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/") ||
+		strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// errorCode turns a status code into a stable error code, such as
+// "bad_request" for 400
+func errorCode(statusCode int) string {
+	text := http.StatusText(statusCode)
+	if text == "" {
+		return "error"
+	}
+	return strings.ToLower(strings.ReplaceAll(text, " ", "_"))
+}
+
+// requestID returns the ID the logging middleware gave the request, so the
+// client can quote it when reporting errors and it matches the logs. Outside
+// the middleware it falls back to the ID the client sent or a new one, and
+// echoes it back
+func requestID(w http.ResponseWriter, r *http.Request) string {
+	if id := logging.RequestID(r.Context()); id != "" {
+		return id
+	}
+	id := r.Header.Get(logging.RequestIDHeader)
+	if !logging.ValidRequestID(id) {
+		id = logging.NewRequestID()
+	}
+	w.Header().Set(logging.RequestIDHeader, id)
+	return id
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"sort"
+	"strconv"
+
+	"groupie-tracker/internal/models"
+	"groupie-tracker/internal/search"
+)
+
+// countFacets counts the artists in hits by member count, country, city,
+// creation decade and first album decade. An artist counts once per value,
+// however many of its concerts share it. Members and decades are listed in
+// ascending order, countries and cities by descending count, then name.
+func countFacets(index *search.Index, hits []search.Hit) *models.Facets {
+	members := make(map[string]int)
+	countries := make(map[string]int)
+	cities := make(map[string]int)
+	creation := make(map[string]int)
+	album := make(map[string]int)
+
+	for _, hit := range hits {
+		doc := index.Doc(hit.Doc)
+		artist := doc.Artist
+
+		members[strconv.Itoa(len(artist.Members))]++
+		creation[decade(artist.CreationDate)]++
+		if !artist.FirstAlbumDate.IsZero() {
+			album[decade(artist.FirstAlbumDate.Year())]++
+		}
+
+		seenCountries := make(map[string]bool)
+		seenCities := make(map[string]bool)
+		for _, place := range doc.Places {
+			if place.Country != "" && !seenCountries[place.Country] {
+				seenCountries[place.Country] = true
+				countries[place.Country]++
+			}
+			if name := place.Name(); name != "" && !seenCities[name] {
+				seenCities[name] = true
+				cities[name]++
+			}
+		}
+	}
+
+	return &models.Facets{
+		Members:           facetCounts(members, byNumber),
+		Countries:         facetCounts(countries, byCount),
+		Cities:            facetCounts(cities, byCount),
+		CreationDecades:   facetCounts(creation, byNumber),
+		FirstAlbumDecades: facetCounts(album, byNumber),
+	}
+}
+
+// decade names the decade of year, such as "1970s"
+func decade(year int) string {
+	return strconv.Itoa(year-year%10) + "s"
+}
+
+// byNumber orders facet values that start with a number numerically
+func byNumber(a, b models.FacetCount) bool {
+	return leadingNumber(a.Value) < leadingNumber(b.Value)
+}
+
+// byCount orders facet values by descending count, then by name
+func byCount(a, b models.FacetCount) bool {
+	if a.Count != b.Count {
+		return a.Count > b.Count
+	}
+	return a.Value < b.Value
+}
+
+func leadingNumber(s string) int {
+	n := 0
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			break
+		}
+		n = n*10 + int(r-'0')
+	}
+	return n
+}
+
+// facetCounts lists counts in the given order, never as nil so clients
+// always receive a list
+func facetCounts(counts map[string]int, less func(a, b models.FacetCount) bool) []models.FacetCount {
+	list := make([]models.FacetCount, 0, len(counts))
+	for value, count := range counts {
+		list = append(list, models.FacetCount{Value: value, Count: count})
+	}
+	sort.Slice(list, func(i, j int) bool { return less(list[i], list[j]) })
+	return list
+}
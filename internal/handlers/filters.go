@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"groupie-tracker/internal/models"
+)
+
+// readFilters reads the search filters from the query string and, when the
+// request has one, a JSON body. Fields set in the body override the query
+// string, so existing POST clients keep working unchanged.
+func readFilters(r *http.Request) (models.FilterParams, error) {
+	filters, err := filtersFromQuery(r.URL.Query())
+	if err != nil {
+		return filters, err
+	}
+
+	if r.Body == nil {
+		return filters, nil
+	}
+	if err := json.NewDecoder(r.Body).Decode(&filters); err != nil && !errors.Is(err, io.EOF) {
+		return filters, errors.New("Invalid filter parameters")
+	}
+	return filters, nil
+}
+
+// filtersFromQuery reads filters from URL query parameters named like the
+// FilterParams JSON fields, e.g.
+//
+//	?creationYearMin=1970&members=4&members=5&countries=USA&sort=-creation&limit=10&fields=id,name&facets=true
+//
+// Lists repeat their parameter; members and fields may also be
+// comma-separated. Omitted parameters leave the filter unset.
+func filtersFromQuery(values url.Values) (models.FilterParams, error) {
+	var filters models.FilterParams
+
+	years := []struct {
+		name   string
+		target *int
+	}{
+		{"creationYearMin", &filters.CreationYearMin},
+		{"creationYearMax", &filters.CreationYearMax},
+		{"firstAlbumYearMin", &filters.FirstAlbumYearMin},
+		{"firstAlbumYearMax", &filters.FirstAlbumYearMax},
+	}
+	for _, year := range years {
+		value := values.Get(year.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return filters, fmt.Errorf("Invalid %s %q, want a year", year.name, value)
+		}
+		*year.target = n
+	}
+
+	for _, value := range values["members"] {
+		for _, part := range strings.Split(value, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || n < 1 {
+				return filters, fmt.Errorf("Invalid members %q, want member counts", value)
+			}
+			filters.Members = append(filters.Members, n)
+		}
+	}
+
+	filters.Locations = values["locations"]
+	filters.Countries = values["countries"]
+	filters.Cities = values["cities"]
+	filters.Sort = values.Get("sort")
+
+	counts := []struct {
+		name   string
+		min    int
+		target *int
+	}{
+		{"page", 1, &filters.Page},
+		{"limit", 1, &filters.Limit},
+		{"offset", 0, &filters.Offset},
+	}
+	for _, count := range counts {
+		value := values.Get(count.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < count.min {
+			return filters, fmt.Errorf("Invalid %s %q, want a number from %d", count.name, value, count.min)
+		}
+		*count.target = n
+	}
+	filters.Cursor = values.Get("cursor")
+
+	if value := values.Get("facets"); value != "" {
+		facets, err := strconv.ParseBool(value)
+		if err != nil {
+			return filters, fmt.Errorf("Invalid facets %q, want true or false", value)
+		}
+		filters.Facets = facets
+	}
+
+	for _, value := range values["fields"] {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				filters.Fields = append(filters.Fields, field)
+			}
+		}
+	}
+
+	return filters, nil
+}
+
+// inRange reports whether year lies within min and max, a zero bound being
+// unbounded.
+func inRange(year, min, max int) bool {
+	return (min == 0 || year >= min) && (max == 0 || year <= max)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"log/slog"
+	"time"
+
+	"groupie-tracker/internal/cache"
+	"groupie-tracker/internal/geocoding"
+	"groupie-tracker/internal/models"
+	"groupie-tracker/internal/search"
+)
+
+// Handlers serves the pages and API of one tracker instance from the cache
+// and geocoder it is given, keeping no package-level state. Build it with
+// New.
+type Handlers struct {
+	cache    *cache.Cache
+	geocoder *geocoding.Resolver
+	logger   *slog.Logger
+
+	// now is the reference time concerts are classified as past or
+	// upcoming against. It defaults to the wall clock and can be pinned
+	// with SetNow.
+	now func() time.Time
+
+	// maxEdits is the default typo tolerance for search and suggestions
+	maxEdits int
+
+	// maxStaleness is the oldest the cached data may be for the instance
+	// to report itself ready
+	maxStaleness time.Duration
+
+	// clientConfig is the configuration pages and /api/config hand to the
+	// browser
+	clientConfig models.ClientConfig
+}
+
+// DefaultMaxStaleness is the oldest the cached data may be for the
+// instance to report itself ready, unless changed with SetMaxStaleness.
+const DefaultMaxStaleness = 3 * time.Hour
+
+// New returns handlers reading artists from c and placing concerts with g,
+// logging to logger.
+func New(c *cache.Cache, g *geocoding.Resolver, logger *slog.Logger) *Handlers {
+	return &Handlers{
+		cache:        c,
+		geocoder:     g,
+		logger:       logger,
+		now:          time.Now,
+		maxEdits:     search.DefaultMaxEdits,
+		maxStaleness: DefaultMaxStaleness,
+	}
+}
+
+// SetNow pins the reference time for event classification, e.g. to replay
+// the dataset's tour dates as if they were current.
+func (h *Handlers) SetNow(t time.Time) {
+	h.now = func() time.Time { return t }
+}
+
+// SetFuzziness sets the default typo tolerance: how many single-character
+// edits a query word may be away from a match. 0 disables fuzzy matching.
+func (h *Handlers) SetFuzziness(edits int) {
+	h.maxEdits = edits
+}
+
+// SetMaxStaleness sets the oldest the cached data may be for /readyz to
+// report the instance ready.
+func (h *Handlers) SetMaxStaleness(d time.Duration) {
+	h.maxStaleness = d
+}
+
+// SetClientConfig sets the configuration served to the browser, so values
+// such as the Mapbox token come from the server's settings rather than the
+// scripts.
+func (h *Handlers) SetClientConfig(c models.ClientConfig) {
+	h.clientConfig = c
+}
@@ -2,17 +2,86 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"html/template"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"groupie-tracker/internal/cache"
+	"groupie-tracker/internal/geocoding"
+	"groupie-tracker/internal/logging"
 	"groupie-tracker/internal/models"
+	"groupie-tracker/internal/search"
 )
 
+var (
+	// fixturesDir holds the upstream fixtures, resolved before TestMain
+	// changes directory.
+	fixturesDir string
+
+	// gazetteer is the bundled gazetteer, loaded once and shared by every
+	// test's geocoder.
+	gazetteer *geocoding.Gazetteer
+)
+
+// TestMain runs from the repository root so the templates and bundled
+// gazetteer resolve.
+func TestMain(m *testing.M) {
+	var err error
+	fixturesDir, err = filepath.Abs("testdata")
+	if err != nil {
+		panic(err)
+	}
+	if err := os.Chdir(filepath.Join("..", "..")); err != nil {
+		panic(err)
+	}
+
+	gazetteer, err = geocoding.LoadGazetteer(geocoding.DefaultGazetteer)
+	if err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// newHandlers returns handlers with their own cache loaded from the
+// fixtures in testdata and geocoding with the bundled gazetteer, so tests
+// run without network access and without sharing state.
+func newHandlers(t *testing.T) *Handlers {
+	t.Helper()
+	return newHandlersWith(t, gazetteer)
+}
+
+// newHandlersWith is newHandlers geocoding with provider.
+func newHandlersWith(t *testing.T, provider geocoding.Geocoder) *Handlers {
+	t.Helper()
+	c := cache.New(time.Hour, cache.NewFileSource(fixturesDir))
+	c.SetLogger(logging.Discard())
+	t.Cleanup(c.Close)
+	if err := c.RefreshCache(context.Background()); err != nil {
+		t.Fatalf("RefreshCache() error = %v", err)
+	}
+
+	g, err := geocoding.New(provider, "", 1)
+	if err != nil {
+		t.Fatalf("geocoding.New() error = %v", err)
+	}
+	g.SetLogger(logging.Discard())
+	return New(c, g, logging.Discard())
+}
+
 // TestHandleArtistDetails tests the artist details handler
 func TestHandleArtistDetails(t *testing.T) {
+	h := newHandlers(t)
 	tmpl := template.Must(template.New("artist-details").Parse(`{{.ArtistID}}`))
 
 	tests := []struct {
@@ -46,7 +115,7 @@ func TestHandleArtistDetails(t *testing.T) {
 			req := httptest.NewRequest("GET", tt.urlPath, nil)
 			w := httptest.NewRecorder()
 
-			handler := HandleArtistDetails(tmpl)
+			handler := h.HandleArtistDetails(tmpl)
 			handler(w, req)
 
 			if got := w.Code; got != tt.expectedStatus {
@@ -61,8 +130,66 @@ func TestHandleArtistDetails(t *testing.T) {
 	}
 }
 
+// TestHandleIndex tests that the search page is rendered with the browser
+// configuration
+func TestHandleIndex(t *testing.T) {
+	h := newHandlers(t)
+	h.SetClientConfig(models.ClientConfig{MapboxToken: "pk.test"})
+	tmpl := template.Must(template.New("index").Parse(`<meta name="mapbox-token" content="{{.Config.MapboxToken}}">`))
+
+	tests := []struct {
+		name           string
+		urlPath        string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"Root", "/", http.StatusOK, `<meta name="mapbox-token" content="pk.test">`},
+		{"Unknown page", "/nowhere", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.HandleIndex(tmpl)(w, httptest.NewRequest("GET", tt.urlPath, nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("HandleIndex() status code = %v, want %v", w.Code, tt.expectedStatus)
+			}
+			if tt.expectedBody != "" && w.Body.String() != tt.expectedBody {
+				t.Errorf("HandleIndex() body = %q, want %q", w.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+}
+
+// TestHandleConfig tests the browser configuration endpoint
+func TestHandleConfig(t *testing.T) {
+	h := newHandlers(t)
+	h.SetClientConfig(models.ClientConfig{MapboxToken: "pk.test"})
+
+	w := httptest.NewRecorder()
+	h.HandleConfig(w, httptest.NewRequest("GET", "/api/config", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("HandleConfig() status code = %v, want %v", w.Code, http.StatusOK)
+	}
+	var got models.ClientConfig
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.MapboxToken != "pk.test" {
+		t.Errorf("HandleConfig() mapboxToken = %q, want pk.test", got.MapboxToken)
+	}
+
+	w = httptest.NewRecorder()
+	h.HandleConfig(w, httptest.NewRequest("POST", "/api/config", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("HandleConfig() POST status code = %v, want %v", w.Code, http.StatusMethodNotAllowed)
+	}
+}
+
 // TestHandleArtist tests the artist API handler
 func TestHandleArtist(t *testing.T) {
+	h := newHandlers(t)
 	tests := []struct {
 		name           string
 		urlPath        string
@@ -85,7 +212,7 @@ func TestHandleArtist(t *testing.T) {
 			req := httptest.NewRequest("GET", tt.urlPath, nil)
 			w := httptest.NewRecorder()
 
-			HandleArtist(w, req)
+			h.HandleArtist(w, req)
 
 			if got := w.Code; got != tt.expectedStatus {
 				t.Errorf("HandleArtist() status code = %v, want %v", got, tt.expectedStatus)
@@ -94,13 +221,91 @@ func TestHandleArtist(t *testing.T) {
 	}
 }
 
+// TestErrorHandler tests JSON errors for API clients and error pages
+// for browsers
+func TestErrorHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		accept    string
+		requestID string
+		wantJSON  bool
+	}{
+		{"API route", "/api/search", "", "", true},
+		{"API route with request ID", "/api/artist/9", "text/html", "abc-123", true},
+		{"Page accepting JSON", "/artist/1", "application/json", "", true},
+		{"Page", "/missing", "text/html", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Accept", tt.accept)
+			req.Header.Set("X-Request-ID", tt.requestID)
+			w := httptest.NewRecorder()
+
+			ErrorHandler(w, req, http.StatusNotFound, "Artist not found")
+
+			if w.Code != http.StatusNotFound {
+				t.Errorf("ErrorHandler() status code = %v, want %v", w.Code, http.StatusNotFound)
+			}
+			if !tt.wantJSON {
+				if !strings.Contains(w.Body.String(), "404 - Artist not found") {
+					t.Errorf("ErrorHandler() body = %q, want the error page", w.Body.String())
+				}
+				return
+			}
+
+			if got := w.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("ErrorHandler() Content-Type = %q, want application/json", got)
+			}
+			var body models.APIError
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode response body: %v", err)
+			}
+			if body.Code != "not_found" || body.Message != "Artist not found" {
+				t.Errorf("ErrorHandler() body = %+v, want not_found: Artist not found", body)
+			}
+			if body.RequestID == "" || body.RequestID != w.Header().Get("X-Request-ID") {
+				t.Errorf("ErrorHandler() request ID = %q, header %q, want matching IDs", body.RequestID, w.Header().Get("X-Request-ID"))
+			}
+			if tt.requestID != "" && body.RequestID != tt.requestID {
+				t.Errorf("ErrorHandler() request ID = %q, want the client's %q", body.RequestID, tt.requestID)
+			}
+		})
+	}
+}
+
+// TestSearchErrorDetails tests that query syntax errors report their column
+func TestSearchErrorDetails(t *testing.T) {
+	h := newHandlers(t)
+	req := httptest.NewRequest("GET", "/api/search?q=created:soon", nil)
+	w := httptest.NewRecorder()
+
+	h.HandleSearch(w, req)
+
+	var body struct {
+		Code    string         `json:"code"`
+		Details map[string]int `json:"details"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response body: %v", err)
+	}
+	if w.Code != http.StatusBadRequest || body.Code != "bad_request" || body.Details["column"] != 9 {
+		t.Errorf("HandleSearch() = %d %+v, want bad_request at column 9", w.Code, body)
+	}
+}
+
 // TestHandleSearch tests the search functionality
 func TestHandleSearch(t *testing.T) {
+	h := newHandlers(t)
 	tests := []struct {
 		name           string
 		query          string
 		filters        models.FilterParams
 		expectedStatus int
+		includes       string // an artist the results must contain
+		excludes       string // an artist the results must not contain
 	}{
 		{
 			name:  "Valid search with filters",
@@ -133,6 +338,33 @@ func TestHandleSearch(t *testing.T) {
 			},
 			expectedStatus: http.StatusOK, // Still returns OK with empty results
 		},
+		{
+			name:           "Query syntax",
+			query:          "member:freddie%20created:1970..1980",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Invalid query syntax",
+			query:          "created:soon",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Fuzzy search",
+			query:          "queeen",
+			expectedStatus: http.StatusOK,
+			includes:       "Queen",
+		},
+		{
+			name:           "Fuzzy search disabled",
+			query:          "queeen&fuzzy=0",
+			expectedStatus: http.StatusOK,
+			excludes:       "Queen",
+		},
+		{
+			name:           "Invalid fuzziness",
+			query:          "queeen&fuzzy=fast",
+			expectedStatus: http.StatusBadRequest,
+		},
 	}
 
 	for _, tt := range tests {
@@ -145,7 +377,7 @@ func TestHandleSearch(t *testing.T) {
 			req := httptest.NewRequest("POST", "/api/search?q="+tt.query, bytes.NewBuffer(filterJSON))
 			w := httptest.NewRecorder()
 
-			HandleSearch(w, req)
+			h.HandleSearch(w, req)
 
 			if got := w.Code; got != tt.expectedStatus {
 				t.Errorf("HandleSearch() status code = %v, want %v", got, tt.expectedStatus)
@@ -157,6 +389,16 @@ func TestHandleSearch(t *testing.T) {
 				if err != nil {
 					t.Errorf("Failed to decode response body: %v", err)
 				}
+				found := make(map[string]bool)
+				for _, artist := range result.Artists {
+					found[artist.Name] = true
+				}
+				if tt.includes != "" && !found[tt.includes] {
+					t.Errorf("HandleSearch() artists = %v, want %s", found, tt.includes)
+				}
+				if tt.excludes != "" && found[tt.excludes] {
+					t.Errorf("HandleSearch() artists = %v, want no %s", found, tt.excludes)
+				}
 			}
 		})
 	}
@@ -164,6 +406,7 @@ func TestHandleSearch(t *testing.T) {
 
 // TestHandleSuggestions tests the suggestions functionality
 func TestHandleSuggestions(t *testing.T) {
+	h := newHandlers(t)
 	tests := []struct {
 		name           string
 		query          string
@@ -184,6 +427,26 @@ func TestHandleSuggestions(t *testing.T) {
 			query:          "test@123",
 			expectedStatus: http.StatusOK,
 		},
+		{
+			name:           "Invalid fuzziness",
+			query:          "queen&fuzzy=9",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Limits",
+			query:          "a&limit=3&perType=1",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Invalid limit",
+			query:          "a&limit=0",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid per type limit",
+			query:          "a&perType=many",
+			expectedStatus: http.StatusBadRequest,
+		},
 	}
 
 	for _, tt := range tests {
@@ -191,7 +454,7 @@ func TestHandleSuggestions(t *testing.T) {
 			req := httptest.NewRequest("GET", "/api/suggestions?q="+tt.query, nil)
 			w := httptest.NewRecorder()
 
-			HandleSuggestions(w, req)
+			h.HandleSuggestions(w, req)
 
 			if got := w.Code; got != tt.expectedStatus {
 				t.Errorf("HandleSuggestions() status code = %v, want %v", got, tt.expectedStatus)
@@ -208,3 +471,502 @@ func TestHandleSuggestions(t *testing.T) {
 	}
 }
 
+// TestSearchPlaces tests searching and filtering by parsed places
+func TestSearchPlaces(t *testing.T) {
+	h := newHandlers(t)
+	index, err := h.cache.GetIndex(context.Background())
+	if err != nil {
+		t.Fatalf("GetIndex() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		filters  models.FilterParams
+		expected []string
+	}{
+		{
+			name:     "Display name query",
+			query:    "los angeles",
+			expected: []string{"Queen", "Phil Collins"},
+		},
+		{
+			name:     "Country filter",
+			filters:  models.FilterParams{Countries: []string{"Mexico"}},
+			expected: []string{"SOJA", "Pink Floyd"},
+		},
+		{
+			name:     "Country code filter",
+			filters:  models.FilterParams{Countries: []string{"gb"}},
+			expected: []string{"Pink Floyd"},
+		},
+		{
+			name:     "City filter is exact",
+			filters:  models.FilterParams{Cities: []string{"Mexico"}},
+			expected: nil,
+		},
+		{
+			name:     "City filter",
+			filters:  models.FilterParams{Cities: []string{"Mexico City"}},
+			expected: []string{"Pink Floyd"},
+		},
+		{
+			name:     "Country term",
+			query:    "country:mexico -name:soja",
+			expected: []string{"Pink Floyd"},
+		},
+		{
+			name:     "Query and filter",
+			query:    "created:1960..1980",
+			filters:  models.FilterParams{Countries: []string{"USA"}},
+			expected: []string{"Queen", "Phil Collins"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filters.CreationYearMax = 3000
+			tt.filters.FirstAlbumYearMax = 3000
+
+			result, err := searchArtists(tt.query, index, tt.filters, search.DefaultMaxEdits)
+			if err != nil {
+				t.Fatalf("searchArtists() error = %v", err)
+			}
+			var got []string
+			for _, artist := range result.Artists {
+				got = append(got, artist.Name)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("searchArtists() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestHandleSearchQueryString tests searching with filters in the URL
+func TestHandleSearchQueryString(t *testing.T) {
+	h := newHandlers(t)
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		expectedStatus int
+		expected       string
+	}{
+		{"No filters", "GET", "/api/search", "", http.StatusOK, "Queen,SOJA,Pink Floyd,Phil Collins"},
+		{"Open lower bound", "GET", "/api/search?creationYearMax=1970", "", http.StatusOK, "Queen,Pink Floyd"},
+		{"Open upper bound", "GET", "/api/search?firstAlbumYearMin=1980", "", http.StatusOK, "SOJA,Phil Collins"},
+		{"Repeated list", "GET", "/api/search?countries=Mexico&countries=France", "", http.StatusOK, "SOJA,Pink Floyd,Phil Collins"},
+		{"Comma-separated members", "GET", "/api/search?members=1,5", "", http.StatusOK, "Pink Floyd,Phil Collins"},
+		{"Locations with commas", "GET", "/api/search?locations=" + url.QueryEscape("Los Angeles, USA"), "", http.StatusOK, "Queen,Phil Collins"},
+		{"Query and sort", "GET", "/api/search?q=country:usa&sort=-creation", "", http.StatusOK, "Phil Collins,Queen"},
+		{"Sort by name", "GET", "/api/search?sort=name", "", http.StatusOK, "Phil Collins,Pink Floyd,Queen,SOJA"},
+		{"Sort by member count", "GET", "/api/search?sort=-members", "", http.StatusOK, "SOJA,Queen,Pink Floyd,Phil Collins"},
+		{"Sort by concert count", "GET", "/api/search?sort=concerts", "", http.StatusOK, "Pink Floyd,Phil Collins,SOJA,Queen"},
+		{"Limit and offset", "GET", "/api/search?limit=2&offset=1", "", http.StatusOK, "SOJA,Pink Floyd"},
+		{"Offset past the end", "GET", "/api/search?offset=10", "", http.StatusOK, ""},
+		{"Limit too large", "GET", "/api/search?limit=1000", "", http.StatusBadRequest, ""},
+		{"Offset and page", "GET", "/api/search?offset=1&page=2", "", http.StatusBadRequest, ""},
+		{"Invalid cursor", "GET", "/api/search?cursor=abc", "", http.StatusBadRequest, ""},
+		{"Empty POST body", "POST", "/api/search?creationYearMin=1975", "", http.StatusOK, "SOJA,Phil Collins"},
+		{"Body overrides query string", "POST", "/api/search?creationYearMin=1975", `{"creationYearMin": 1990}`, http.StatusOK, "SOJA"},
+		{"Invalid year", "GET", "/api/search?creationYearMin=soon", "", http.StatusBadRequest, ""},
+		{"Invalid members", "GET", "/api/search?members=four", "", http.StatusBadRequest, ""},
+		{"Invalid sort", "GET", "/api/search?sort=genre", "", http.StatusBadRequest, ""},
+		{"Invalid page", "GET", "/api/search?page=0", "", http.StatusBadRequest, ""},
+		{"Invalid body", "POST", "/api/search", "{", http.StatusBadRequest, ""},
+		{"Method not allowed", "DELETE", "/api/search", "", http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			h.HandleSearch(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("HandleSearch() status code = %v, want %v", w.Code, tt.expectedStatus)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var result models.SearchResult
+			if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+				t.Fatalf("Failed to decode response body: %v", err)
+			}
+			var got []string
+			for _, artist := range result.Artists {
+				got = append(got, artist.Name)
+			}
+			if strings.Join(got, ",") != tt.expected {
+				t.Errorf("HandleSearch() = %v, want %v", got, tt.expected)
+			}
+			if result.Limit == 0 && result.Offset == 0 && result.Total != len(got) {
+				t.Errorf("HandleSearch() total = %d, want %d", result.Total, len(got))
+			}
+		})
+	}
+}
+
+// TestSearchPages tests paging through search results
+func TestSearchPages(t *testing.T) {
+	h := newHandlers(t)
+	index, err := h.cache.GetIndex(context.Background())
+	if err != nil {
+		t.Fatalf("GetIndex() error = %v", err)
+	}
+
+	result, err := searchArtists("", index, models.FilterParams{Page: 1}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Page != 1 || result.Pages != 1 || result.Total != 4 || len(result.Artists) != 4 {
+		t.Errorf("page 1 = page %d of %d, %d of %d artists, want all 4 artists on page 1 of 1",
+			result.Page, result.Pages, len(result.Artists), result.Total)
+	}
+
+	result, _ = searchArtists("", index, models.FilterParams{Page: 2}, 0)
+	if len(result.Artists) != 0 || result.Total != 4 {
+		t.Errorf("page 2 = %d of %d artists, want none of 4", len(result.Artists), result.Total)
+	}
+
+	tests := []struct {
+		name    string
+		filters models.FilterParams
+		valid   bool
+	}{
+		{"Last offset", models.FilterParams{Offset: maxOffset, Limit: 1}, true},
+		{"Last page", models.FilterParams{Page: maxOffset/pageSize + 1}, true},
+		{"Huge offset", models.FilterParams{Offset: math.MaxInt, Limit: 1}, false},
+		{"Huge page", models.FilterParams{Page: 922337203685477581, Limit: 20}, false},
+		{"Huge page of default size", models.FilterParams{Page: 461168601842738791}, false},
+		{"Page past the offset cap", models.FilterParams{Page: maxOffset/pageSize + 2}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := searchArtists("", index, tt.filters, 0)
+			if (err == nil) != tt.valid {
+				t.Fatalf("searchArtists() error = %v, want valid %v", err, tt.valid)
+			}
+			if len(result.Artists) != 0 {
+				t.Errorf("searchArtists() = %d artists, want none", len(result.Artists))
+			}
+		})
+	}
+}
+
+// TestSearchCursor tests following nextCursor through every page
+func TestSearchCursor(t *testing.T) {
+	h := newHandlers(t)
+	index, err := h.cache.GetIndex(context.Background())
+	if err != nil {
+		t.Fatalf("GetIndex() error = %v", err)
+	}
+
+	filters := models.FilterParams{Limit: 3, Sort: "name"}
+	var got []string
+	for pages := 0; ; pages++ {
+		if pages == 3 {
+			t.Fatalf("searchArtists() did not stop issuing cursors after %v", got)
+		}
+		result, err := searchArtists("", index, filters, 0)
+		if err != nil {
+			t.Fatalf("searchArtists() error = %v", err)
+		}
+		if result.Total != 4 {
+			t.Errorf("searchArtists() total = %d, want 4", result.Total)
+		}
+		for _, artist := range result.Artists {
+			got = append(got, artist.Name)
+		}
+		if result.NextCursor == "" {
+			break
+		}
+		filters.Cursor = result.NextCursor
+	}
+	if strings.Join(got, ",") != "Phil Collins,Pink Floyd,Queen,SOJA" {
+		t.Errorf("pages = %v, want every artist once, by name", got)
+	}
+
+	// A cursor only continues the search that issued it
+	_, err = searchArtists("queen", index, filters, 0)
+	if err == nil {
+		t.Error("searchArtists() with another search's cursor succeeded, want an error")
+	}
+
+	// An edited cursor cannot reach past the offset cap
+	filters.Cursor = encodeCursor(math.MaxInt, searchFingerprint("", filters))
+	if _, err := searchArtists("", index, filters, 0); err == nil {
+		t.Error("searchArtists() with a cursor at math.MaxInt succeeded, want an error")
+	}
+}
+
+// TestSearchFields tests trimming artists to the requested fields
+func TestSearchFields(t *testing.T) {
+	h := newHandlers(t)
+	req := httptest.NewRequest("GET", "/api/search?q=queen&fields=id,name", nil)
+	w := httptest.NewRecorder()
+	h.HandleSearch(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("HandleSearch() status code = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	var result struct {
+		Artists []map[string]interface{} `json:"artists"`
+		Total   int                      `json:"total"`
+		Hits    []models.Hit             `json:"hits"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode response body: %v", err)
+	}
+	if len(result.Artists) != 1 || len(result.Artists[0]) != 2 || result.Artists[0]["name"] != "Queen" {
+		t.Errorf("HandleSearch() artists = %v, want Queen with id and name only", result.Artists)
+	}
+	if result.Total != 1 || len(result.Hits) != 1 {
+		t.Errorf("HandleSearch() total = %d, hits = %v, want the envelope kept", result.Total, result.Hits)
+	}
+
+	req = httptest.NewRequest("GET", "/api/search?fields=id,genre", nil)
+	w = httptest.NewRecorder()
+	h.HandleSearch(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("HandleSearch() with unknown field status code = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+}
+
+// TestSearchFacets tests facet counts over the whole result set
+func TestSearchFacets(t *testing.T) {
+	h := newHandlers(t)
+	index, err := h.cache.GetIndex(context.Background())
+	if err != nil {
+		t.Fatalf("GetIndex() error = %v", err)
+	}
+
+	format := func(counts []models.FacetCount) string {
+		var parts []string
+		for _, c := range counts {
+			parts = append(parts, fmt.Sprintf("%s:%d", c.Value, c.Count))
+		}
+		return strings.Join(parts, ",")
+	}
+
+	result, err := searchArtists("", index, models.FilterParams{Facets: true, Limit: 1}, 0)
+	if err != nil {
+		t.Fatalf("searchArtists() error = %v", err)
+	}
+	if result.Facets == nil {
+		t.Fatal("searchArtists() facets = nil, want counts")
+	}
+	facets := result.Facets
+	tests := []struct {
+		name     string
+		got      []models.FacetCount
+		expected string
+	}{
+		{"Members", facets.Members, "1:1,5:1,7:1,8:1"},
+		{"Creation decades", facets.CreationDecades, "1960s:1,1970s:2,1990s:1"},
+		{"First album decades", facets.FirstAlbumDecades, "1960s:1,1970s:1,1980s:1,2000s:1"},
+	}
+	for _, tt := range tests {
+		if got := format(tt.got); got != tt.expected {
+			t.Errorf("%s facet = %s, want %s", tt.name, got, tt.expected)
+		}
+	}
+	if got := format(facets.Countries[:3]); got != "Mexico:2,USA:2,France:1" {
+		t.Errorf("Countries facet starts %s, want Mexico:2,USA:2,France:1", got)
+	}
+	if got := format(facets.Cities[:1]); got != "Los Angeles:2" {
+		t.Errorf("Cities facet starts %s, want Los Angeles:2", got)
+	}
+
+	// Facets follow the filters but not the page
+	result, _ = searchArtists("", index, models.FilterParams{Facets: true, Countries: []string{"USA"}}, 0)
+	if got := format(result.Facets.Countries); got != "USA:2,France:1,Germany:1,Japan:1,New Zealand:1" {
+		t.Errorf("Countries facet with USA filter = %s", got)
+	}
+
+	result, _ = searchArtists("", index, models.FilterParams{}, 0)
+	if result.Facets != nil {
+		t.Errorf("searchArtists() facets = %+v, want none unless requested", result.Facets)
+	}
+}
+
+// TestSearchHits tests that search results are ranked and explained
+func TestSearchHits(t *testing.T) {
+	h := newHandlers(t)
+	index, err := h.cache.GetIndex(context.Background())
+	if err != nil {
+		t.Fatalf("GetIndex() error = %v", err)
+	}
+	filters := models.FilterParams{CreationYearMax: 3000, FirstAlbumYearMax: 3000}
+
+	result, _ := searchArtists("ph", index, filters, 0)
+	if len(result.Artists) != 2 || len(result.Hits) != 2 {
+		t.Fatalf("searchArtists(ph) = %+v, want two artists with hits", result)
+	}
+	for i, hit := range result.Hits {
+		if hit.ID != result.Artists[i].ID || len(hit.Matches) == 0 {
+			t.Errorf("hit %d = %+v, want an explained hit for %s", i, hit, result.Artists[i].Name)
+		}
+	}
+	if result.Artists[0].Name != "Phil Collins" || result.Hits[0].Matches[0].Field != "artist/band" {
+		t.Errorf("searchArtists(ph) ranked %s first, want the name match Phil Collins", result.Artists[0].Name)
+	}
+
+	result, _ = searchArtists("1970", index, filters, 0)
+	if len(result.Hits) != 1 || result.Hits[0].Matches[0].Field != "created date" {
+		t.Errorf("searchArtists(1970) hits = %+v, want one creation date match", result.Hits)
+	}
+
+	result, _ = searchArtists("", index, filters, 0)
+	if len(result.Artists) != index.Len() || result.Hits != nil {
+		t.Errorf("searchArtists() = %d artists, %d hits, want all artists and no hits", len(result.Artists), len(result.Hits))
+	}
+}
+
+// TestLocationSuggestions tests that locations are suggested by display name
+func TestLocationSuggestions(t *testing.T) {
+	h := newHandlers(t)
+	index, err := h.cache.GetIndex(context.Background())
+	if err != nil {
+		t.Fatalf("GetIndex() error = %v", err)
+	}
+
+	suggestions := getSuggestions("carolina", index, search.DefaultMaxEdits, defaultSuggestions, suggestionsPerType)
+	if len(suggestions) != 1 || suggestions[0].Text != "North Carolina, USA" || suggestions[0].Type != "location" {
+		t.Errorf("getSuggestions(carolina) = %+v, want North Carolina, USA", suggestions)
+	}
+}
+
+// TestHandleArtistEvents tests the concert timeline in artist details
+func TestHandleArtistEvents(t *testing.T) {
+	h := newHandlers(t)
+	req := httptest.NewRequest("GET", "/api/artist/2?now=2019-12-06", nil)
+	w := httptest.NewRecorder()
+
+	h.HandleArtist(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("HandleArtist() status code = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	var details models.ArtistDetail
+	if err := json.NewDecoder(w.Body).Decode(&details); err != nil {
+		t.Fatalf("Failed to decode response body: %v", err)
+	}
+
+	if len(details.Events) != 5 {
+		t.Fatalf("len(Events) = %d, want 5", len(details.Events))
+	}
+	first, last := details.Events[0], details.Events[4]
+	if first.Place != "Noumea, New Caledonia" || first.Upcoming {
+		t.Errorf("Events[0] = %+v, want past Noumea concert", first)
+	}
+	if last.Date.Format("2006-01-02") != "2019-12-07" || !last.Upcoming {
+		t.Errorf("Events[4] = %+v, want upcoming 2019-12-07 concert", last)
+	}
+	if len(details.Locations) != 3 || details.Locations[0].Name != "Playa del Carmen, Mexico" {
+		t.Errorf("Locations = %+v, want three geocoded places", details.Locations)
+	}
+
+	req = httptest.NewRequest("GET", "/api/artist/2?now=yesterday", nil)
+	w = httptest.NewRecorder()
+	h.HandleArtist(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("HandleArtist() with invalid now status code = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+}
+
+// TestHealthEndpoints tests the liveness and readiness probes
+func TestHealthEndpoints(t *testing.T) {
+	h := newHandlers(t)
+
+	empty := cache.New(time.Hour, cache.NewFileSource(t.TempDir()))
+	g, err := geocoding.New(gazetteer, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unloaded := New(empty, g, logging.Discard())
+
+	stale := newHandlers(t)
+	stale.SetMaxStaleness(time.Nanosecond)
+
+	tests := []struct {
+		name           string
+		handler        http.HandlerFunc
+		method         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"Healthy", h.HandleHealth, "GET", http.StatusOK, "ok\n"},
+		{"Healthy without data", unloaded.HandleHealth, "GET", http.StatusOK, "ok\n"},
+		{"Ready", h.HandleReady, "GET", http.StatusOK, "ready\n"},
+		{"Ready HEAD", h.HandleReady, "HEAD", http.StatusOK, "ready\n"},
+		{"Not loaded", unloaded.HandleReady, "GET", http.StatusServiceUnavailable, "not ready: no data loaded yet\n"},
+		{"Too stale", stale.HandleReady, "GET", http.StatusServiceUnavailable, "not ready: data is"},
+		{"Method not allowed", h.HandleReady, "POST", http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.handler(w, httptest.NewRequest(tt.method, "/readyz", nil))
+			if w.Code != tt.expectedStatus {
+				t.Errorf("status code = %v, want %v", w.Code, tt.expectedStatus)
+			}
+			if !strings.HasPrefix(w.Body.String(), tt.expectedBody) {
+				t.Errorf("body = %q, want it to start with %q", w.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+}
+
+// TestHandleStatus tests the data freshness and geocoding report
+func TestHandleStatus(t *testing.T) {
+	h := newHandlers(t)
+	h.HandleArtist(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/artist/1", nil))
+	h.HandleArtist(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/artist/1", nil))
+
+	w := httptest.NewRecorder()
+	h.HandleStatus(w, httptest.NewRequest("GET", "/api/status", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("HandleStatus() status code = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	var status models.Status
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if !status.Ready || status.Artists != 4 || status.LastRefresh == nil || status.LastRefreshError != "" {
+		t.Errorf("HandleStatus() = %+v, want a ready cache of 4 artists without errors", status)
+	}
+	geo := status.Geocoding
+	if geo.CacheEntries == 0 || geo.Misses != int64(geo.CacheEntries) || geo.Hits != geo.Misses || geo.HitRate != 0.5 {
+		t.Errorf("HandleStatus() geocoding = %+v, want the second lookup of each place answered from the cache", geo)
+	}
+}
+
+// TestHandleStatusHidesToken tests that a failing Mapbox request is
+// reported without the access token in its URL
+func TestHandleStatusHidesToken(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	h := newHandlersWith(t, geocoding.NewMapbox(srv.URL, "sk.SECRET"))
+	h.HandleArtist(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/artist/1", nil))
+
+	w := httptest.NewRecorder()
+	h.HandleStatus(w, httptest.NewRequest("GET", "/api/status", nil))
+	var status models.Status
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Geocoding.LastError == "" {
+		t.Fatalf("HandleStatus() = %s, want the geocoding failure reported", w.Body)
+	}
+	if strings.Contains(w.Body.String(), "sk.SECRET") {
+		t.Errorf("HandleStatus() = %s, exposes the access token", w.Body)
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"groupie-tracker/internal/models"
+)
+
+// HandleHealth reports that the process is up and serving. It checks
+// nothing else, so a failing upstream never gets the process restarted.
+func (h *Handlers) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintln(w, "ok")
+}
+
+// HandleReady reports whether the instance should receive traffic: its
+// cache is loaded and no older than the maximum staleness. Otherwise it
+// answers 503 with the reason.
+func (h *Handlers) HandleReady(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if reason := h.notReady(); reason != "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, "not ready:", reason)
+		return
+	}
+	fmt.Fprintln(w, "ready")
+}
+
+// HandleStatus reports the data being served, the last refresh and the
+// geocoding cache as a models.Status.
+func (h *Handlers) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	cached := h.cache.Status()
+	geo := h.geocoder.Stats()
+	status := models.Status{
+		Ready:              h.notReady() == "",
+		LastRefresh:        optionalTime(cached.FetchedAt),
+		DataAgeSeconds:     int(h.cache.Age() / time.Second),
+		ExpiresAt:          optionalTime(cached.ExpiresAt),
+		LastRefreshAttempt: optionalTime(cached.LastAttempt),
+		Artists:            cached.Artists,
+		Geocoding: models.GeocodingStatus{
+			CacheEntries: geo.Entries,
+			Hits:         geo.Hits,
+			Misses:       geo.Misses,
+			HitRate:      geo.HitRate(),
+			LastErrorAt:  optionalTime(geo.LastErrorAt),
+		},
+	}
+	if cached.LastError != nil {
+		status.LastRefreshError = cached.LastError.Error()
+	}
+	if geo.LastError != nil {
+		status.Geocoding.LastError = geo.LastError.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(status)
+}
+
+// notReady explains why the instance is not ready, or returns "" when it
+// is.
+func (h *Handlers) notReady() string {
+	if h.cache.LastRefresh().IsZero() {
+		return "no data loaded yet"
+	}
+	if age := h.cache.Age(); age > h.maxStaleness {
+		return fmt.Sprintf("data is %s old, more than the maximum %s", age.Round(time.Second), h.maxStaleness)
+	}
+	return ""
+}
+
+// allowGet answers 405 to requests other than GET and HEAD, reporting
+// whether the request may proceed.
+func allowGet(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return true
+	}
+	w.Header().Set("Allow", "GET, HEAD")
+	ErrorHandler(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	return false
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+
+	"groupie-tracker/internal/models"
+)
+
+// pageSize is the number of artists per page when paging by page number
+// without a limit
+const pageSize = 20
+
+// maxLimit caps the number of artists per page
+const maxLimit = 100
+
+// maxOffset caps how far into the results a page may start, far beyond any
+// real result set, so page arithmetic cannot overflow
+const maxOffset = 1_000_000
+
+// cursor is the decoded form of a nextCursor: the offset of the next page
+// and a fingerprint of the search it belongs to
+type cursor struct {
+	Offset int    `json:"o"`
+	Search string `json:"s"`
+}
+
+// artistFields are the JSON fields of an artist the fields parameter may
+// select
+var artistFields = func() map[string]bool {
+	encoded, _ := json.Marshal(models.Artist{})
+	var fields map[string]json.RawMessage
+	json.Unmarshal(encoded, &fields)
+
+	names := make(map[string]bool, len(fields))
+	for name := range fields {
+		names[name] = true
+	}
+	return names
+}()
+
+// pageWindow returns the offset and limit of the requested page. A zero
+// limit means every result from offset on.
+func pageWindow(q string, filters models.FilterParams) (offset, limit int, err error) {
+	if filters.Limit < 0 || filters.Limit > maxLimit {
+		return 0, 0, fmt.Errorf("Invalid limit %d, want a number from 1 to %d", filters.Limit, maxLimit)
+	}
+	if filters.Offset < 0 || filters.Offset > maxOffset {
+		return 0, 0, fmt.Errorf("Invalid offset %d, want a number from 0 to %d", filters.Offset, maxOffset)
+	}
+	if filters.Page < 0 {
+		return 0, 0, fmt.Errorf("Invalid page %d, want a number from 1", filters.Page)
+	}
+
+	set := 0
+	for _, isSet := range []bool{filters.Offset > 0, filters.Cursor != "", filters.Page > 0} {
+		if isSet {
+			set++
+		}
+	}
+	if set > 1 {
+		return 0, 0, errors.New("Use only one of offset, cursor and page")
+	}
+
+	limit = filters.Limit
+	switch {
+	case filters.Cursor != "":
+		offset, err = decodeCursor(filters.Cursor, searchFingerprint(q, filters))
+	case filters.Page > 0:
+		if limit == 0 {
+			limit = pageSize
+		}
+		if maxPage := maxOffset/limit + 1; filters.Page > maxPage {
+			return 0, 0, fmt.Errorf("Invalid page %d, want a number from 1 to %d", filters.Page, maxPage)
+		}
+		offset = (filters.Page - 1) * limit
+	default:
+		offset = filters.Offset
+	}
+	return offset, limit, err
+}
+
+// searchFingerprint identifies a search regardless of the page requested,
+// so a cursor cannot be replayed against a different search
+func searchFingerprint(q string, filters models.FilterParams) string {
+	filters.Page, filters.Limit, filters.Offset, filters.Cursor = 0, 0, 0, ""
+	filters.Fields, filters.Facets = nil, false
+	encoded, _ := json.Marshal(filters)
+
+	h := fnv.New64a()
+	h.Write([]byte(q))
+	h.Write([]byte{0})
+	h.Write(encoded)
+	return fmt.Sprintf("%x", h.Sum64())
+}
+
+func encodeCursor(offset int, fingerprint string) string {
+	encoded, _ := json.Marshal(cursor{Offset: offset, Search: fingerprint})
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeCursor(value, fingerprint string) (int, error) {
+	var c cursor
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err == nil {
+		err = json.Unmarshal(decoded, &c)
+	}
+	if err != nil || c.Offset < 0 || c.Offset > maxOffset {
+		return 0, errors.New("Invalid cursor")
+	}
+	if c.Search != fingerprint {
+		return 0, errors.New("Cursor belongs to a different search")
+	}
+	return c.Offset, nil
+}
+
+// checkFields validates a fields parameter against the artist JSON fields
+func checkFields(fields []string) error {
+	for _, field := range fields {
+		if !artistFields[field] {
+			known := make([]string, 0, len(artistFields))
+			for name := range artistFields {
+				known = append(known, name)
+			}
+			sort.Strings(known)
+			return fmt.Errorf("Invalid field %q, want any of %s", field, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+// projectedResult is a SearchResult whose artists only carry the requested
+// fields. Its Artists field shadows the embedded one when encoded.
+type projectedResult struct {
+	models.SearchResult
+	Artists []map[string]json.RawMessage `json:"artists"`
+}
+
+// project trims the artists in results to the given JSON fields. Without
+// fields the results are returned unchanged.
+func project(results models.SearchResult, fields []string) (interface{}, error) {
+	if len(fields) == 0 {
+		return results, nil
+	}
+
+	projected := projectedResult{SearchResult: results, Artists: []map[string]json.RawMessage{}}
+	for _, artist := range results.Artists {
+		encoded, err := json.Marshal(artist)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(encoded, &all); err != nil {
+			return nil, err
+		}
+
+		trimmed := make(map[string]json.RawMessage, len(fields))
+		for _, field := range fields {
+			trimmed[field] = all[field]
+		}
+		projected.Artists = append(projected.Artists, trimmed)
+	}
+	return projected, nil
+}
@@ -2,111 +2,220 @@ package handlers
 
 import (
     "encoding/json"
+    "errors"
+    "fmt"
     "net/http"
+    "sort"
     "strconv"
     "strings"
-    "groupie-tracker/internal/cache"
     "groupie-tracker/internal/models"
+    "groupie-tracker/internal/places"
+    "groupie-tracker/internal/query"
+    "groupie-tracker/internal/search"
 )
 
-// HandleSearch handles the search API endpoint
-func HandleSearch(w http.ResponseWriter, r *http.Request) {
-    query := r.URL.Query().Get("q")
-    var filters models.FilterParams
-    err := json.NewDecoder(r.Body).Decode(&filters)
+// maxFuzziness caps the typo tolerance a request may ask for
+const maxFuzziness = search.MaxEdits
+
+// fuzziness returns the typo tolerance for a request, which may override
+// the default with the fuzzy query parameter
+func (h *Handlers) fuzziness(r *http.Request) (int, error) {
+    param := r.URL.Query().Get("fuzzy")
+    if param == "" {
+        return h.maxEdits, nil
+    }
+    edits, err := strconv.Atoi(param)
+    if err != nil || edits < 0 || edits > maxFuzziness {
+        return 0, fmt.Errorf("fuzzy must be a number from 0 to %d", maxFuzziness)
+    }
+    return edits, nil
+}
+
+// sortKeys are the search orders besides relevance, by name in the sort
+// parameter. Prefixing a name with "-" reverses the order.
+var sortKeys = map[string]func(a, b search.Document) bool{
+    "name": func(a, b search.Document) bool {
+        return strings.ToLower(a.Artist.Name) < strings.ToLower(b.Artist.Name)
+    },
+    "creation": func(a, b search.Document) bool {
+        return a.Artist.CreationDate < b.Artist.CreationDate
+    },
+    "album": func(a, b search.Document) bool {
+        return a.Artist.FirstAlbumDate.Before(b.Artist.FirstAlbumDate)
+    },
+    "members": func(a, b search.Document) bool {
+        return len(a.Artist.Members) < len(b.Artist.Members)
+    },
+    "concerts": func(a, b search.Document) bool {
+        return a.Concerts < b.Concerts
+    },
+}
+
+// HandleSearch handles the search API endpoint. Filters are read from the
+// query string, so results can be bookmarked and cached, or from a JSON
+// body for POST requests.
+func (h *Handlers) HandleSearch(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPost {
+        w.Header().Set("Allow", "GET, HEAD, POST")
+        ErrorHandler(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+        return
+    }
+
+    q := r.URL.Query().Get("q")
+    filters, err := readFilters(r)
     if err != nil {
-        ErrorHandler(w, r, http.StatusBadRequest, "Invalid filter parameters")
+        ErrorHandler(w, r, http.StatusBadRequest, err.Error())
         return
     }
 
-    cachedData, err := cache.GetCachedData()
+    edits, err := h.fuzziness(r)
+    if err != nil {
+        ErrorHandler(w, r, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    index, err := h.cache.GetIndex(r.Context())
     if err != nil {
         ErrorHandler(w, r, http.StatusInternalServerError, "Failed to fetch data")
         return
     }
+    h.setDataAge(w)
+
+    if err := checkFields(filters.Fields); err != nil {
+        ErrorHandler(w, r, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    results, err := searchArtists(q, index, filters, edits)
+    var syntaxErr *query.SyntaxError
+    if errors.As(err, &syntaxErr) {
+        errorWithDetails(w, r, http.StatusBadRequest, err.Error(), map[string]int{"column": syntaxErr.Pos + 1})
+        return
+    }
+    if err != nil {
+        ErrorHandler(w, r, http.StatusBadRequest, err.Error())
+        return
+    }
 
-    results := searchArtists(query, cachedData, filters)
-    json.NewEncoder(w).Encode(results)
+    response, err := project(results, filters.Fields)
+    if err != nil {
+        ErrorHandler(w, r, http.StatusInternalServerError, "Failed to encode results")
+        return
+    }
+    json.NewEncoder(w).Encode(response)
 }
 
-func searchArtists(query string, cachedData models.Datas, filters models.FilterParams) models.SearchResult {
+// searchArtists runs a query in the syntax of the query package, such as
+// `member:freddie created:1970..1980`, applies the filters to the matching
+// artists and returns the requested page in the requested order. Invalid
+// queries return a *query.SyntaxError.
+func searchArtists(q string, index *search.Index, filters models.FilterParams, edits int) (models.SearchResult, error) {
     var results models.SearchResult
-    lowercaseQuery := strings.ToLower(query)
-
-    // Try to parse query as a year
-    queryYear, err := strconv.Atoi(query)
-    isYearQuery := err == nil && len(query) == 4
 
-    // Create a map of artist ID to locations for quick lookup
-    artistLocations := make(map[int][]string)
-    for _, loc := range cachedData.LocationsData.Index {
-        artistLocations[loc.ID] = loc.Locations
+    less, err := sortOrder(filters.Sort)
+    if err != nil {
+        return results, err
+    }
+    offset, limit, err := pageWindow(q, filters)
+    if err != nil {
+        return results, err
+    }
+    node, err := query.Parse(q)
+    if err != nil {
+        return results, err
     }
 
-    for _, artist := range cachedData.ArtistsData {
-        // Get locations for this artist
-        locations := artistLocations[artist.ID]
-        
-        // Check if artist matches filters first
-        if !matchesFilters(artist, locations, filters) {
-            continue
+    // Narrow the artists down to those matching the query, best first; an
+    // empty query includes all artists that match filters
+    var hits []search.Hit
+    for _, hit := range index.Query(node, edits) {
+        if matchesFilters(index.Doc(hit.Doc), filters) {
+            hits = append(hits, hit)
         }
+    }
+    if less != nil {
+        // Stable, so equal artists stay in order of relevance
+        sort.SliceStable(hits, func(i, j int) bool {
+            return less(index.Doc(hits[i].Doc), index.Doc(hits[j].Doc))
+        })
+    }
 
-        // If query is empty, include all artists that match filters
-        if query == "" {
-            results.Artists = append(results.Artists, artist)
-            continue
-        }
+    results.Total = len(hits)
+    if filters.Facets {
+        results.Facets = countFacets(index, hits)
+    }
+    results.Offset = offset
+    results.Limit = limit
+    if filters.Page > 0 {
+        results.Page = filters.Page
+        results.Pages = (len(hits) + limit - 1) / limit
+    }
 
-        var matches bool
-        
-        // If it's a year query, ONLY check the creation date
-        if isYearQuery {
-            matches = (queryYear == artist.CreationDate)
-        } else {
-            // For non-year queries, check other fields
-            matches = strings.Contains(strings.ToLower(artist.Name), lowercaseQuery) ||
-                     containsAny(artist.Members, lowercaseQuery) ||
-                     strings.Contains(strings.ToLower(artist.FirstAlbum), lowercaseQuery) ||
-                     containsLocation(locations, lowercaseQuery)
+    end := len(hits)
+    if limit > 0 {
+        if offset < len(hits) && limit < len(hits)-offset {
+            end = offset + limit
+        }
+        if end < len(hits) {
+            results.NextCursor = encodeCursor(end, searchFingerprint(q, filters))
         }
+    }
+    hits = hits[min(offset, end):end]
 
-        if matches {
-            results.Artists = append(results.Artists, artist)
+    for _, hit := range hits {
+        doc := index.Doc(hit.Doc)
+        results.Artists = append(results.Artists, doc.Artist)
+        if node != nil {
+            results.Hits = append(results.Hits, models.Hit{ID: doc.Artist.ID, Score: hit.Score, Matches: hit.Matches})
         }
     }
-    return results
+    return results, nil
 }
 
-// containsLocation checks if any location contains the search query
-func containsLocation(locations []string, query string) bool {
-    for _, location := range locations {
-        if strings.Contains(strings.ToLower(strings.TrimSpace(location)), query) {
-            return true
-        }
+// sortOrder returns the ordering named by the sort parameter, or nil to keep
+// results in order of relevance
+func sortOrder(name string) (func(a, b search.Document) bool, error) {
+    if name == "" || name == "relevance" {
+        return nil, nil
     }
-    return false
+    key, descending := strings.CutPrefix(name, "-")
+    less, ok := sortKeys[key]
+    if !ok {
+        return nil, fmt.Errorf("Invalid sort %q, want relevance, name, creation, album, members or concerts", name)
+    }
+    if descending {
+        return func(a, b search.Document) bool { return less(b, a) }, nil
+    }
+    return less, nil
 }
 
-func containsAny(slice []string, substr string) bool {
-    for _, s := range slice {
-        if strings.Contains(strings.ToLower(s), substr) {
+// containsLocation checks if any of the artist's locations contains the
+// search query, either as spelled upstream or by its display name
+func containsLocation(doc search.Document, query string) bool {
+    for i, location := range doc.Locations {
+        if strings.Contains(strings.ToLower(location), query) ||
+            strings.Contains(strings.ToLower(doc.Places[i].String()), query) {
             return true
         }
     }
     return false
 }
 
-func matchesFilters(artist models.Artist, locations []string, filters models.FilterParams) bool {
+func matchesFilters(doc search.Document, filters models.FilterParams) bool {
+    artist := doc.Artist
+
     // Check creation year
-    if artist.CreationDate < filters.CreationYearMin || artist.CreationDate > filters.CreationYearMax {
+    if !inRange(artist.CreationDate, filters.CreationYearMin, filters.CreationYearMax) {
         return false
     }
 
-    // Check first album year
-    firstAlbumYear, _ := strconv.Atoi(strings.Split(artist.FirstAlbum, "-")[2])
-    if firstAlbumYear < filters.FirstAlbumYearMin || firstAlbumYear > filters.FirstAlbumYearMax {
-        return false
+    // Check first album year; invalid dates were reported at load time and
+    // only pass when the album years are unbounded
+    if filters.FirstAlbumYearMin != 0 || filters.FirstAlbumYearMax != 0 {
+        if artist.FirstAlbumDate.IsZero() ||
+            !inRange(artist.FirstAlbumDate.Year(), filters.FirstAlbumYearMin, filters.FirstAlbumYearMax) {
+            return false
+        }
     }
 
     // Check number of members
@@ -120,15 +229,9 @@ func matchesFilters(artist models.Artist, locations []string, filters models.Fil
     // Check locations
     if len(filters.Locations) > 0 {
         matched := false
-        for _, loc := range locations {
-            loc = strings.TrimSpace(loc)
-            for _, filterLoc := range filters.Locations {
-                if strings.Contains(strings.ToLower(loc), strings.ToLower(filterLoc)) {
-                    matched = true
-                    break
-                }
-            }
-            if matched {
+        for _, filterLoc := range filters.Locations {
+            if containsLocation(doc, strings.ToLower(filterLoc)) {
+                matched = true
                 break
             }
         }
@@ -137,9 +240,29 @@ func matchesFilters(artist models.Artist, locations []string, filters models.Fil
         }
     }
 
+    // Check countries and cities, which must match a place exactly
+    if len(filters.Countries) > 0 && !anyPlace(doc.Places, filters.Countries, places.Place.MatchesCountry) {
+        return false
+    }
+    if len(filters.Cities) > 0 && !anyPlace(doc.Places, filters.Cities, places.Place.MatchesCity) {
+        return false
+    }
+
     return true
 }
 
+// anyPlace reports whether any place matches any of the wanted names
+func anyPlace(artistPlaces []places.Place, wanted []string, matches func(places.Place, string) bool) bool {
+    for _, place := range artistPlaces {
+        for _, name := range wanted {
+            if matches(place, name) {
+                return true
+            }
+        }
+    }
+    return false
+}
+
 // contains checks if a slice contains a value
 func contains(slice []int, val int) bool {
     for _, item := range slice {
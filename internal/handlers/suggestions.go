@@ -2,86 +2,73 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
-	"strings"
 	"strconv"
 
-	"groupie-tracker/internal/cache"
 	"groupie-tracker/internal/models"
+	"groupie-tracker/internal/search"
 )
 
-// HandleSuggestions handles the suggestions API endpoint
-func HandleSuggestions(w http.ResponseWriter, r *http.Request) {
+// Suggestion caps: how many suggestions are returned by default, how many
+// a request may ask for, and how many of one type are returned by default
+const (
+    defaultSuggestions = 10
+    maxSuggestions     = 50
+    suggestionsPerType = 5
+)
+
+// HandleSuggestions handles the suggestions API endpoint. The optional
+// limit and perType parameters cap the suggestions returned overall and
+// per type.
+func (h *Handlers) HandleSuggestions(w http.ResponseWriter, r *http.Request) {
     query := r.URL.Query().Get("q")
     if query == "" {
         ErrorHandler(w, r, http.StatusBadRequest, "Missing search query")
         return
     }
 
-    cachedData, err := cache.GetCachedData()
+    edits, err := h.fuzziness(r)
+    if err != nil {
+        ErrorHandler(w, r, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    limit, err := suggestionLimit(r, "limit", defaultSuggestions)
+    if err != nil {
+        ErrorHandler(w, r, http.StatusBadRequest, err.Error())
+        return
+    }
+    perType, err := suggestionLimit(r, "perType", suggestionsPerType)
+    if err != nil {
+        ErrorHandler(w, r, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    index, err := h.cache.GetIndex(r.Context())
     if err != nil {
         ErrorHandler(w, r, http.StatusInternalServerError, "Failed to fetch data")
         return
     }
+    h.setDataAge(w)
 
-    suggestions := getSuggestions(query, cachedData)
+    suggestions := getSuggestions(query, index, edits, limit, perType)
     json.NewEncoder(w).Encode(suggestions)
 }
 
-func getSuggestions(query string, cachedData models.Datas) []models.Suggestion {
-    var suggestions []models.Suggestion
-    lowercaseQuery := strings.ToLower(query)
-    
-    // Use a map to prevent duplicate suggestions
-    uniqueSuggestions := make(map[string]bool)
-
-    // Create a map of artist ID to locations for quick lookup
-    artistLocations := make(map[int][]string)
-    for _, loc := range cachedData.LocationsData.Index {
-        artistLocations[loc.ID] = loc.Locations
+// suggestionLimit reads a suggestion cap from the named query parameter
+func suggestionLimit(r *http.Request, name string, fallback int) (int, error) {
+    param := r.URL.Query().Get(name)
+    if param == "" {
+        return fallback, nil
     }
-
-    for _, artist := range cachedData.ArtistsData {
-        // Artist name suggestions
-        if strings.Contains(strings.ToLower(artist.Name), lowercaseQuery) {
-            addUniqueSuggestion(&suggestions, uniqueSuggestions, artist.Name, "artist/band")
-        }
-
-        // Member suggestions
-        for _, member := range artist.Members {
-            if strings.Contains(strings.ToLower(member), lowercaseQuery) {
-                addUniqueSuggestion(&suggestions, uniqueSuggestions, member, "member")
-            }
-        }
-
-        // First album suggestions
-        if strings.Contains(strings.ToLower(artist.FirstAlbum), lowercaseQuery) {
-            addUniqueSuggestion(&suggestions, uniqueSuggestions, artist.FirstAlbum, "first album")
-        }
-
-        // Creation date suggestions
-        if strings.Contains(strconv.Itoa(artist.CreationDate), query) {
-            addUniqueSuggestion(&suggestions, uniqueSuggestions, strconv.Itoa(artist.CreationDate), "created date")
-        }
-
-        // Location suggestions
-        locations := artistLocations[artist.ID]
-        for _, location := range locations {
-            location = strings.TrimSpace(location)
-            if strings.Contains(strings.ToLower(location), lowercaseQuery) {
-                addUniqueSuggestion(&suggestions, uniqueSuggestions, location, "location")
-            }
-        }
+    n, err := strconv.Atoi(param)
+    if err != nil || n < 1 || n > maxSuggestions {
+        return 0, fmt.Errorf("Invalid %s %q, want a number from 1 to %d", name, param, maxSuggestions)
     }
-
-    return suggestions
+    return n, nil
 }
 
-// addUniqueSuggestion adds a suggestion if it hasn't been added before
-func addUniqueSuggestion(suggestions *[]models.Suggestion, unique map[string]bool, text, sugType string) {
-    key := text + "|" + sugType
-    if !unique[key] {
-        *suggestions = append(*suggestions, models.Suggestion{Text: text, Type: sugType})
-        unique[key] = true
-    }
-}
\ No newline at end of file
+func getSuggestions(query string, index *search.Index, edits, limit, perType int) []models.Suggestion {
+    return index.Suggest(query, edits, limit, perType)
+}
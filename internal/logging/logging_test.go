@@ -0,0 +1,148 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// records decodes the JSON log records written to buf.
+func records(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// TestValidRequestID tests which client request IDs are reused
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		id       string
+		expected bool
+	}{
+		{"abc-123", true},
+		{"0f8fad5b-d9cb-469f-a165-70867728950e", true},
+		{"", false},
+		{"has space", false},
+		{"line\nbreak", false},
+		{"café", false},
+		{strings.Repeat("a", 128), true},
+		{strings.Repeat("a", 129), false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidRequestID(tt.id); got != tt.expected {
+			t.Errorf("ValidRequestID(%q) = %v, want %v", tt.id, got, tt.expected)
+		}
+	}
+}
+
+// TestMiddleware tests that requests get an ID, which is echoed back,
+// carried by records logged while serving them and by the request record
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		incoming   string
+		expectSame bool
+	}{
+		{"Client ID", "client-id-1", true},
+		{"No ID", "", false},
+		{"Invalid ID", "not valid", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := New(&buf)
+			handler := Middleware(logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				logger.InfoContext(r.Context(), "Looking up")
+				w.WriteHeader(http.StatusTeapot)
+				w.Write([]byte("short and stout"))
+			}))
+
+			req := httptest.NewRequest("GET", "/api/artist/1?now=2020-01-01", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			id := w.Header().Get(RequestIDHeader)
+			if tt.expectSame && id != tt.incoming {
+				t.Errorf("X-Request-ID = %q, want the client's %q", id, tt.incoming)
+			}
+			if !tt.expectSame && (id == tt.incoming || !ValidRequestID(id)) {
+				t.Errorf("X-Request-ID = %q, want a new ID", id)
+			}
+
+			logged := records(t, &buf)
+			if len(logged) != 2 {
+				t.Fatalf("logged %d records, want 2: %s", len(logged), buf.String())
+			}
+			for _, record := range logged {
+				if record["request_id"] != id {
+					t.Errorf("record %v request_id = %v, want %q", record["msg"], record["request_id"], id)
+				}
+			}
+			served := logged[1]
+			if served["method"] != "GET" || served["path"] != "/api/artist/1" ||
+				served["status"] != float64(http.StatusTeapot) || served["bytes"] != float64(len("short and stout")) {
+				t.Errorf("request record = %v, want GET /api/artist/1 with status 418 and 15 bytes", served)
+			}
+			if duration, ok := served["duration"].(float64); !ok || duration <= 0 || duration > 1 {
+				t.Errorf("request record = %v, want a duration in seconds", served)
+			}
+		})
+	}
+}
+
+// TestHandlerWithoutRequestID tests that records logged outside a request
+// have no request_id and that attributes added with With are kept
+func TestHandlerWithoutRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf).With("component", "cache")
+	logger.Info("Refreshed")
+	logger.InfoContext(WithRequestID(context.Background(), "abc"), "Refreshed")
+
+	logged := records(t, &buf)
+	if _, ok := logged[0]["request_id"]; ok {
+		t.Errorf("record = %v, want no request_id", logged[0])
+	}
+	if logged[1]["request_id"] != "abc" {
+		t.Errorf("record = %v, want request_id abc", logged[1])
+	}
+	for _, record := range logged {
+		if record["component"] != "cache" {
+			t.Errorf("record = %v, want the component attribute", record)
+		}
+	}
+}
+
+// TestRecorder tests that a response is wrapped once and its status and
+// size recorded
+func TestRecorder(t *testing.T) {
+	rec := Recorder(httptest.NewRecorder())
+	if Recorder(rec) != rec {
+		t.Error("Recorder(rec) wrapped a ResponseRecorder again")
+	}
+	if rec.Status() != http.StatusOK {
+		t.Errorf("Status() = %d before writing, want %d", rec.Status(), http.StatusOK)
+	}
+
+	rec.WriteHeader(http.StatusNotFound)
+	rec.WriteHeader(http.StatusInternalServerError)
+	rec.Write([]byte("not found"))
+	if rec.Status() != http.StatusNotFound || rec.Bytes() != int64(len("not found")) {
+		t.Errorf("Status(), Bytes() = %d, %d, want %d, %d", rec.Status(), rec.Bytes(), http.StatusNotFound, len("not found"))
+	}
+}
@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Middleware gives every request an ID, reusing a valid one sent in
+// X-Request-ID, echoes it in the response and makes it available to the
+// handlers through the request context. Once the response is written it
+// logs the request's method, path, status, size and duration to logger.
+func Middleware(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(RequestIDHeader)
+		if !ValidRequestID(id) {
+			id = NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		ctx := WithRequestID(r.Context(), id)
+
+		rec := Recorder(w)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		level := slog.LevelInfo
+		if rec.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logger.LogAttrs(ctx, level, "Request served",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Int64("bytes", rec.bytes),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote", r.RemoteAddr),
+		)
+	})
+}
+
+// ResponseRecorder remembers the status code and counts the body bytes
+// written through it. Middleware wraps each response in one, which other
+// middleware reuse through Recorder rather than wrapping it again.
+type ResponseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+// Recorder returns w if it is already a ResponseRecorder, and otherwise
+// wraps it in a new one.
+func Recorder(w http.ResponseWriter) *ResponseRecorder {
+	if rec, ok := w.(*ResponseRecorder); ok {
+		return rec
+	}
+	return &ResponseRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+// Status returns the status code written so far, http.StatusOK if none has
+// been.
+func (r *ResponseRecorder) Status() int {
+	return r.status
+}
+
+// Bytes returns the number of body bytes written so far.
+func (r *ResponseRecorder) Bytes() int64 {
+	return r.bytes
+}
+
+func (r *ResponseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status, r.wroteHeader = status, true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *ResponseRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
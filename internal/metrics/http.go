@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"groupie-tracker/internal/logging"
+)
+
+// HTTP counts requests and times responses per route.
+type HTTP struct {
+	requests *CounterVec
+	duration *HistogramVec
+}
+
+// NewHTTP registers the request metrics on reg.
+func NewHTTP(reg *Registry) *HTTP {
+	return &HTTP{
+		requests: reg.Counter("groupie_http_requests_total",
+			"HTTP requests served, by route, method and status code.",
+			"route", "method", "code"),
+		duration: reg.Histogram("groupie_http_request_duration_seconds",
+			"Time taken to serve HTTP requests, by route.",
+			DefaultBuckets, "route"),
+	}
+}
+
+// Wrap instruments next under route, which should be the pattern it is
+// registered with rather than the request path, so every artist page counts
+// towards one series. It reads the status from the logging middleware's
+// recorder when the response already has one.
+func (m *HTTP) Wrap(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := logging.Recorder(w)
+		next.ServeHTTP(rec, r)
+
+		m.duration.With(route).Observe(time.Since(start).Seconds())
+		m.requests.With(route, method(r.Method), strconv.Itoa(rec.Status())).Inc()
+	})
+}
+
+// method keeps the method label to the standard methods so arbitrary ones
+// cannot create new series.
+func method(m string) string {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return m
+	}
+	return "other"
+}
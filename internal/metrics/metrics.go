@@ -0,0 +1,348 @@
+// Package metrics keeps counters, histograms and gauges and exposes them in
+// the Prometheus text exposition format, so a Prometheus server can scrape
+// them without the tracker depending on its client library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the histogram upper bounds, in seconds, used for
+// request and upstream latencies.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry holds a set of named metrics. Nothing is registered globally:
+// each App creates its own Registry and hands it to its parts.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+// metric is a registered family that can write its samples.
+type metric interface {
+	write(w io.Writer, name string)
+	kind() string
+	help() string
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[name]; ok {
+		panic("metrics: " + name + " registered twice")
+	}
+	r.metrics[name] = m
+}
+
+// Counter registers a counter family partitioned by the given label names.
+// It panics if name is already registered.
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{family: newFamily(help, labels)}
+	r.register(name, v)
+	return v
+}
+
+// Histogram registers a histogram family with the given bucket upper bounds
+// partitioned by the given label names. It panics if name is already
+// registered.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	v := &HistogramVec{family: newFamily(help, labels), buckets: buckets}
+	r.register(name, v)
+	return v
+}
+
+// GaugeFunc registers a gauge whose value is read from f at every scrape.
+// It panics if name is already registered.
+func (r *Registry) GaugeFunc(name, help string, f func() float64) {
+	r.register(name, &valueFunc{typ: "gauge", helpText: help, f: f})
+}
+
+// CounterFunc registers a counter whose value is read from f at every
+// scrape, for counts another package already keeps. f must never return
+// less than it did before. It panics if name is already registered.
+func (r *Registry) CounterFunc(name, help string, f func() float64) {
+	r.register(name, &valueFunc{typ: "counter", helpText: help, f: f})
+}
+
+// WriteTo writes every metric in the Prometheus text format, sorted by name
+// and then by label values.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.metrics))
+	metrics := make(map[string]metric, len(r.metrics))
+	for name, m := range r.metrics {
+		names = append(names, name)
+		metrics[name] = m
+	}
+	r.mu.Unlock()
+	sort.Strings(names)
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, name := range names {
+		m := metrics[name]
+		fmt.Fprintf(bw, "# HELP %s %s\n", name, escapeHelp(m.help()))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, m.kind())
+		m.write(bw, name)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler serves the registry in the Prometheus text format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		r.WriteTo(w)
+	})
+}
+
+// family holds the series of one metric, keyed by their label values.
+type family struct {
+	helpText string
+	labels   []string
+
+	mu     sync.Mutex
+	series map[string][]string
+}
+
+func newFamily(help string, labels []string) family {
+	return family{helpText: help, labels: labels, series: make(map[string][]string)}
+}
+
+func (f *family) help() string { return f.helpText }
+
+// key checks values against the label names and returns the series key.
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: got %d label values for labels %v", len(values), f.labels))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// keys returns the series keys sorted by label values.
+func (f *family) keys() []string {
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// labelPairs formats the series' labels, plus any extra pairs, as
+// {name="value",...}, or nothing when there are none.
+func (f *family) labelPairs(values []string, extra ...string) string {
+	var pairs []string
+	for i, name := range f.labels {
+		pairs = append(pairs, name+`="`+escapeLabel(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabel(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// CounterVec is a counter family. Use With to pick a series.
+type CounterVec struct {
+	family
+	counters map[string]*Counter
+}
+
+// With returns the counter for the given label values, in the order the
+// labels were registered, creating it at zero on first use.
+func (v *CounterVec) With(values ...string) *Counter {
+	key := v.key(values)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.counters == nil {
+		v.counters = make(map[string]*Counter)
+	}
+	c, ok := v.counters[key]
+	if !ok {
+		c = &Counter{}
+		v.counters[key] = c
+		v.series[key] = append([]string(nil), values...)
+	}
+	return c
+}
+
+func (v *CounterVec) kind() string { return "counter" }
+
+func (v *CounterVec) write(w io.Writer, name string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, key := range v.keys() {
+		fmt.Fprintf(w, "%s%s %s\n", name, v.labelPairs(v.series[key]), formatFloat(v.counters[key].Value()))
+	}
+}
+
+// Counter is a value that only goes up.
+type Counter struct {
+	mu    sync.Mutex
+	value float64
+}
+
+// Inc adds one to the counter.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds delta, which must not be negative, to the counter.
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.mu.Lock()
+	c.value += delta
+	c.mu.Unlock()
+}
+
+// Value returns the counter's current value.
+func (c *Counter) Value() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
+
+// HistogramVec is a histogram family. Use With to pick a series.
+type HistogramVec struct {
+	family
+	buckets    []float64
+	histograms map[string]*Histogram
+}
+
+// With returns the histogram for the given label values, in the order the
+// labels were registered, creating it empty on first use.
+func (v *HistogramVec) With(values ...string) *Histogram {
+	key := v.key(values)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.histograms == nil {
+		v.histograms = make(map[string]*Histogram)
+	}
+	h, ok := v.histograms[key]
+	if !ok {
+		h = &Histogram{buckets: v.buckets, counts: make([]uint64, len(v.buckets))}
+		v.histograms[key] = h
+		v.series[key] = append([]string(nil), values...)
+	}
+	return h
+}
+
+func (v *HistogramVec) kind() string { return "histogram" }
+
+func (v *HistogramVec) write(w io.Writer, name string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, key := range v.keys() {
+		values := v.series[key]
+		counts, count, sum := v.histograms[key].snapshot()
+		for i, upper := range v.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, v.labelPairs(values, "le", formatFloat(upper)), counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, v.labelPairs(values, "le", "+Inf"), count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, v.labelPairs(values), formatFloat(sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, v.labelPairs(values), count)
+	}
+}
+
+// Histogram counts observations into buckets and keeps their sum.
+type Histogram struct {
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Observe records one value.
+func (h *Histogram) Observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, upper := range h.buckets {
+		if value <= upper {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// snapshot returns the cumulative bucket counts, the total count and the
+// sum.
+func (h *Histogram) snapshot() ([]uint64, uint64, float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]uint64(nil), h.counts...), h.count, h.sum
+}
+
+// valueFunc is a single gauge or counter read from a function.
+type valueFunc struct {
+	typ      string
+	helpText string
+	f        func() float64
+}
+
+func (v *valueFunc) kind() string { return v.typ }
+func (v *valueFunc) help() string { return v.helpText }
+
+func (v *valueFunc) write(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(v.f()))
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
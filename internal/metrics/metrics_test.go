@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestWriteTo tests the text exposition of every kind of metric
+func TestWriteTo(t *testing.T) {
+	reg := NewRegistry()
+	requests := reg.Counter("requests_total", "Requests served.", "route", "code")
+	requests.With("/b", "200").Inc()
+	requests.With("/a", "404").Add(2)
+	requests.With("/b", "200").Inc()
+	latency := reg.Histogram("latency_seconds", "Request latency.", []float64{1, 0.1})
+	latency.With().Observe(0.05)
+	latency.With().Observe(0.5)
+	latency.With().Observe(3)
+	reg.GaugeFunc("age_seconds", "Age of the data.\nIn seconds.", func() float64 { return 1.5 })
+	reg.CounterFunc("hits_total", "Cache hits.", func() float64 { return 7 })
+
+	var b strings.Builder
+	n, err := reg.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+
+	expected := `# HELP age_seconds Age of the data.\nIn seconds.
+# TYPE age_seconds gauge
+age_seconds 1.5
+# HELP hits_total Cache hits.
+# TYPE hits_total counter
+hits_total 7
+# HELP latency_seconds Request latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 3.55
+latency_seconds_count 3
+# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{route="/a",code="404"} 2
+requests_total{route="/b",code="200"} 2
+`
+	if b.String() != expected {
+		t.Errorf("WriteTo() =\n%s\nwant\n%s", b.String(), expected)
+	}
+	if n != int64(b.Len()) {
+		t.Errorf("WriteTo() = %d bytes, wrote %d", n, b.Len())
+	}
+}
+
+// TestLabelEscaping tests that label values cannot break the format
+func TestLabelEscaping(t *testing.T) {
+	reg := NewRegistry()
+	reg.Counter("c_total", "C.", "path").With("a\"b\\c\nd").Inc()
+
+	var b strings.Builder
+	reg.WriteTo(&b)
+	if expected := `c_total{path="a\"b\\c\nd"} 1`; !strings.Contains(b.String(), expected) {
+		t.Errorf("WriteTo() = %q, want it to contain %q", b.String(), expected)
+	}
+}
+
+// TestRegisterTwice tests that a name cannot be registered twice
+func TestRegisterTwice(t *testing.T) {
+	reg := NewRegistry()
+	reg.Counter("c_total", "C.")
+	defer func() {
+		if recover() == nil {
+			t.Error("registering c_total twice did not panic")
+		}
+	}()
+	reg.GaugeFunc("c_total", "C.", func() float64 { return 0 })
+}
+
+// TestHTTP tests that wrapped handlers are counted by route, method and
+// status code, and that the registry is served over HTTP
+func TestHTTP(t *testing.T) {
+	reg := NewRegistry()
+	m := NewHTTP(reg)
+	artist := m.Wrap("/artist/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/artist/0" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	metrics := m.Wrap("/metrics", reg.Handler())
+
+	for _, path := range []string{"/artist/1", "/artist/2", "/artist/0"} {
+		artist.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	artist.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BREW", "/artist/1", nil))
+
+	w := httptest.NewRecorder()
+	metrics.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /metrics status code = %v, want %v", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("GET /metrics Content-Type = %q, want the Prometheus text format", ct)
+	}
+
+	body := w.Body.String()
+	for _, expected := range []string{
+		`groupie_http_requests_total{route="/artist/",method="GET",code="200"} 2`,
+		`groupie_http_requests_total{route="/artist/",method="GET",code="404"} 1`,
+		`groupie_http_requests_total{route="/artist/",method="other",code="200"} 1`,
+		`groupie_http_request_duration_seconds_count{route="/artist/"} 4`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("GET /metrics = %s\nwant it to contain %q", body, expected)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	metrics.ServeHTTP(w, httptest.NewRequest("POST", "/metrics", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /metrics status code = %v, want %v", w.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -19,6 +19,10 @@ type Artist struct {
 	Locations    string   `json:"locations"`
 	ConcertDates string   `json:"concertDates"`
 	Relations    string   `json:"relations"`
+
+	// FirstAlbumDate is FirstAlbum parsed at cache load time; zero when the
+	// upstream value is invalid.
+	FirstAlbumDate time.Time `json:"-"`
 }
 
 type Location struct {
@@ -48,26 +52,143 @@ type Datas struct {
 	LocationsData Location `json:"locations"`
 	DatesData     Date     `json:"dates"`
 	RelationsData Relation `json:"relations"`
+
+	// ConcertDates holds each artist's parsed concert dates, sorted,
+	// RelationDates the same per artist and location, and Issues the
+	// values that failed validation. All are derived from the raw data
+	// when the cache is loaded.
+	ConcertDates  map[int][]time.Time            `json:"-"`
+	RelationDates map[int]map[string][]time.Time `json:"-"`
+	Issues        []DataIssue                    `json:"-"`
+}
+
+// APIError is the body of error responses on API routes. Code is a stable
+// identifier derived from the HTTP status, such as "bad_request"; Details
+// optionally carries machine-readable context; RequestID identifies the
+// request in server logs.
+type APIError struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"requestId"`
+}
+
+// ClientConfig is the runtime configuration the browser needs, rendered
+// into pages and served by /api/config.
+type ClientConfig struct {
+	MapboxToken string `json:"mapboxToken"`
+}
+
+// Status reports the health of a tracker instance for dashboards. Times
+// and errors are omitted when they do not apply, e.g. before the first
+// refresh.
+type Status struct {
+	Ready              bool            `json:"ready"`
+	LastRefresh        *time.Time      `json:"lastRefresh,omitempty"`
+	DataAgeSeconds     int             `json:"dataAgeSeconds"`
+	ExpiresAt          *time.Time      `json:"expiresAt,omitempty"`
+	LastRefreshAttempt *time.Time      `json:"lastRefreshAttempt,omitempty"`
+	LastRefreshError   string          `json:"lastRefreshError,omitempty"`
+	Artists            int             `json:"artists"`
+	Geocoding          GeocodingStatus `json:"geocoding"`
+}
+
+// GeocodingStatus reports how the geocoding cache is doing and the
+// provider's last failure.
+type GeocodingStatus struct {
+	CacheEntries int        `json:"cacheEntries"`
+	Hits         int64      `json:"hits"`
+	Misses       int64      `json:"misses"`
+	HitRate      float64    `json:"hitRate"`
+	LastError    string     `json:"lastError,omitempty"`
+	LastErrorAt  *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// DataIssue describes an upstream value that failed validation.
+type DataIssue struct {
+	ArtistID int    `json:"artistId"`
+	Field    string `json:"field"`
+	Value    string `json:"value"`
+	Message  string `json:"message"`
 }
 
+// SearchResult is one page of search results. Total counts every matching
+// artist; NextCursor, when set, fetches the page after this one.
 type SearchResult struct {
-	Artists []Artist `json:"artists"`
+	Artists    []Artist `json:"artists"`
+	Hits       []Hit    `json:"hits,omitempty"`
+	Total      int      `json:"total"`
+	Offset     int      `json:"offset"`
+	Limit      int      `json:"limit,omitempty"`
+	Page       int      `json:"page,omitempty"`
+	Pages      int      `json:"pages,omitempty"`
+	NextCursor string   `json:"nextCursor,omitempty"`
+	Facets     *Facets  `json:"facets,omitempty"`
+}
+
+// Facets counts the artists of a whole result set, before paging, by the
+// values the search filters accept, so clients can show how many results
+// each filter option leaves.
+type Facets struct {
+	Members           []FacetCount `json:"members"`
+	Countries         []FacetCount `json:"countries"`
+	Cities            []FacetCount `json:"cities"`
+	CreationDecades   []FacetCount `json:"creationDecades"`
+	FirstAlbumDecades []FacetCount `json:"firstAlbumDecades"`
+}
+
+// FacetCount is the number of artists with a value, such as a member count,
+// a country or a decade like "1970s".
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Hit reports why and how well an artist in a SearchResult matched the
+// query. Score ranges from 0 to 1 and Matches lists the matched field
+// values, best first within each term of the query. Hits are listed in the
+// same order as the artists.
+type Hit struct {
+	ID      int          `json:"id"`
+	Score   float64      `json:"score"`
+	Matches []FieldMatch `json:"matches,omitempty"`
+}
+
+// FieldMatch is a field value that matched a query. Field takes the same
+// values as Suggestion.Type.
+type FieldMatch struct {
+	Field string `json:"field"`
+	Value string `json:"value"`
+	Spans []Span `json:"spans,omitempty"`
+}
+
+// Span is a matched part of a value, as rune offsets from Start up to but
+// not including End.
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
 }
 
+// Suggestion is a value to complete a search with. ArtistIDs lists the
+// artists it belongs to, e.g. a member's band.
 type Suggestion struct {
-	Text string `json:"text"`
-	Type string `json:"type"`
+	Text      string `json:"text"`
+	Type      string `json:"type"`
+	ArtistIDs []int  `json:"artistIds"`
 }
 
 type GeoLocation struct {
 	Address string  `json:"address"`
+	Name    string  `json:"name"`
 	Lat     float64 `json:"lat"`
 	Lon     float64 `json:"lon"`
 }
 
 type Event struct {
 	Location string    `json:"location"`
+	Place    string    `json:"place,omitempty"`
 	Date     time.Time `json:"date"`
+	Upcoming bool      `json:"upcoming"`
 }
 
 type ArtistDetail struct {
@@ -76,8 +197,14 @@ type ArtistDetail struct {
 	Dates     []string            `json:"dates"`
 	Relations map[string][]string `json:"relations"`
 	Events    []Event             `json:"events"`
+	Issues    []DataIssue         `json:"issues,omitempty"`
 }
 
+// FilterParams narrows, orders and pages search results. Zero year bounds
+// are unbounded. A page of results starts at Offset, the position encoded
+// in Cursor, or Page counted from 1, and holds up to Limit artists; with
+// none of them set every result is returned. Fields, when set, trims each
+// artist to the named JSON fields, and Facets adds facet counts.
 type FilterParams struct {
 	CreationYearMin   int      `json:"creationYearMin"`
 	CreationYearMax   int      `json:"creationYearMax"`
@@ -85,4 +212,13 @@ type FilterParams struct {
 	FirstAlbumYearMax int      `json:"firstAlbumYearMax"`
 	Members           []int    `json:"members"`
 	Locations         []string `json:"locations"`
+	Countries         []string `json:"countries"`
+	Cities            []string `json:"cities"`
+	Sort              string   `json:"sort"`
+	Page              int      `json:"page"`
+	Limit             int      `json:"limit"`
+	Offset            int      `json:"offset"`
+	Cursor            string   `json:"cursor"`
+	Fields            []string `json:"fields"`
+	Facets            bool     `json:"facets"`
 }
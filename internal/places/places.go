@@ -0,0 +1,207 @@
+// Package places turns the upstream location strings, such as
+// "los_angeles-usa" or "north_carolina-usa", into structured places with
+// display names.
+package places
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Place is a parsed location. Locations that name a state or region rather
+// than a city fill Region and leave City empty.
+type Place struct {
+	City        string `json:"city,omitempty"`
+	Region      string `json:"region,omitempty"`
+	Country     string `json:"country"`
+	CountryCode string `json:"countryCode,omitempty"`
+}
+
+type country struct {
+	name string
+	code string
+}
+
+// countries maps the upstream country slugs to display names and ISO 3166
+// alpha-2 codes. Unknown slugs are title-cased and have no code.
+var countries = map[string]country{
+	"argentina":            {"Argentina", "AR"},
+	"australia":            {"Australia", "AU"},
+	"austria":              {"Austria", "AT"},
+	"belarus":              {"Belarus", "BY"},
+	"belgium":              {"Belgium", "BE"},
+	"brazil":               {"Brazil", "BR"},
+	"bulgaria":             {"Bulgaria", "BG"},
+	"canada":               {"Canada", "CA"},
+	"chile":                {"Chile", "CL"},
+	"china":                {"China", "CN"},
+	"colombia":             {"Colombia", "CO"},
+	"costa_rica":           {"Costa Rica", "CR"},
+	"croatia":              {"Croatia", "HR"},
+	"czech_republic":       {"Czech Republic", "CZ"},
+	"czechia":              {"Czechia", "CZ"},
+	"denmark":              {"Denmark", "DK"},
+	"egypt":                {"Egypt", "EG"},
+	"estonia":              {"Estonia", "EE"},
+	"finland":              {"Finland", "FI"},
+	"france":               {"France", "FR"},
+	"french_polynesia":     {"French Polynesia", "PF"},
+	"germany":              {"Germany", "DE"},
+	"greece":               {"Greece", "GR"},
+	"hungary":              {"Hungary", "HU"},
+	"iceland":              {"Iceland", "IS"},
+	"india":                {"India", "IN"},
+	"indonesia":            {"Indonesia", "ID"},
+	"ireland":              {"Ireland", "IE"},
+	"israel":               {"Israel", "IL"},
+	"italy":                {"Italy", "IT"},
+	"japan":                {"Japan", "JP"},
+	"latvia":               {"Latvia", "LV"},
+	"lithuania":            {"Lithuania", "LT"},
+	"malaysia":             {"Malaysia", "MY"},
+	"mexico":               {"Mexico", "MX"},
+	"morocco":              {"Morocco", "MA"},
+	"netherlands":          {"Netherlands", "NL"},
+	"netherlands_antilles": {"Netherlands Antilles", "AN"},
+	"new_caledonia":        {"New Caledonia", "NC"},
+	"new_zealand":          {"New Zealand", "NZ"},
+	"nigeria":              {"Nigeria", "NG"},
+	"norway":               {"Norway", "NO"},
+	"peru":                 {"Peru", "PE"},
+	"philippines":          {"Philippines", "PH"},
+	"poland":               {"Poland", "PL"},
+	"portugal":             {"Portugal", "PT"},
+	"qatar":                {"Qatar", "QA"},
+	"romania":              {"Romania", "RO"},
+	"russia":               {"Russia", "RU"},
+	"serbia":               {"Serbia", "RS"},
+	"singapore":            {"Singapore", "SG"},
+	"slovakia":             {"Slovakia", "SK"},
+	"slovenia":             {"Slovenia", "SI"},
+	"south_africa":         {"South Africa", "ZA"},
+	"south_korea":          {"South Korea", "KR"},
+	"spain":                {"Spain", "ES"},
+	"sweden":               {"Sweden", "SE"},
+	"switzerland":          {"Switzerland", "CH"},
+	"taiwan":               {"Taiwan", "TW"},
+	"thailand":             {"Thailand", "TH"},
+	"turkey":               {"Turkey", "TR"},
+	"uk":                   {"UK", "GB"},
+	"ukraine":              {"Ukraine", "UA"},
+	"united_arab_emirates": {"United Arab Emirates", "AE"},
+	"uruguay":              {"Uruguay", "UY"},
+	"usa":                  {"USA", "US"},
+}
+
+// regions lists, per country code, the slugs that name a state, province or
+// region rather than a city. Names shared with a major city, like New York
+// or Quebec, are treated as cities.
+var regions = map[string]map[string]bool{
+	"US": set("alabama", "alaska", "arizona", "arkansas", "california", "colorado",
+		"connecticut", "delaware", "florida", "georgia", "hawaii", "idaho", "illinois",
+		"indiana", "iowa", "kansas", "kentucky", "louisiana", "maine", "maryland",
+		"massachusetts", "michigan", "minnesota", "mississippi", "missouri", "montana",
+		"nebraska", "nevada", "new_hampshire", "new_jersey", "new_mexico",
+		"north_carolina", "north_dakota", "ohio", "oklahoma", "oregon", "pennsylvania",
+		"rhode_island", "south_carolina", "south_dakota", "tennessee", "texas", "utah",
+		"vermont", "virginia", "washington", "west_virginia", "wisconsin", "wyoming"),
+	"AU": set("new_south_wales", "queensland", "south_australia", "tasmania",
+		"victoria", "western_australia"),
+	"CA": set("alberta", "british_columbia", "manitoba", "new_brunswick",
+		"nova_scotia", "ontario", "saskatchewan"),
+}
+
+// lowerWords stay lower case inside display names, as in "Rio de Janeiro".
+var lowerWords = set("de", "del", "da", "do", "dos", "la", "le", "les", "of", "sur", "am")
+
+func set(words ...string) map[string]bool {
+	m := make(map[string]bool, len(words))
+	for _, w := range words {
+		m[w] = true
+	}
+	return m
+}
+
+// Parse parses an upstream location string of the form "city-country".
+// Parsing never fails: a string without a country becomes a city-only
+// place.
+func Parse(raw string) Place {
+	raw = strings.ToLower(strings.TrimSpace(raw))
+	name, countrySlug := raw, ""
+	if i := strings.LastIndex(raw, "-"); i >= 0 {
+		name, countrySlug = raw[:i], raw[i+1:]
+	}
+	name = slug(name)
+	countrySlug = slug(countrySlug)
+
+	var p Place
+	if c, ok := countries[countrySlug]; ok {
+		p.Country, p.CountryCode = c.name, c.code
+	} else {
+		p.Country = titleCase(countrySlug)
+	}
+
+	if regions[p.CountryCode][name] {
+		p.Region = titleCase(name)
+	} else {
+		p.City = titleCase(name)
+	}
+	return p
+}
+
+// Name returns the most specific part of the place: its city, or its region
+// for region-level locations.
+func (p Place) Name() string {
+	if p.City != "" {
+		return p.City
+	}
+	return p.Region
+}
+
+// String returns the display name, such as "Los Angeles, USA".
+func (p Place) String() string {
+	parts := make([]string, 0, 3)
+	for _, part := range []string{p.City, p.Region, p.Country} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// MatchesCountry reports whether country names this place's country, by
+// display name, upstream slug or country code, ignoring case.
+func (p Place) MatchesCountry(country string) bool {
+	country = slug(country)
+	if country == "" {
+		return false
+	}
+	return country == slug(p.Country) || strings.EqualFold(country, p.CountryCode)
+}
+
+// MatchesCity reports whether city names this place's city or region,
+// ignoring case and the difference between spaces and underscores.
+func (p Place) MatchesCity(city string) bool {
+	city = slug(city)
+	return city != "" && city == slug(p.Name())
+}
+
+// slug lower-cases s and joins its words with underscores, the way the
+// upstream spells names.
+func slug(s string) string {
+	s = strings.ToLower(strings.ReplaceAll(s, "_", " "))
+	return strings.Join(strings.Fields(s), "_")
+}
+
+func titleCase(s string) string {
+	words := strings.Fields(strings.ReplaceAll(s, "_", " "))
+	for i, w := range words {
+		if i > 0 && lowerWords[w] {
+			continue
+		}
+		r := []rune(w)
+		r[0] = unicode.ToUpper(r[0])
+		words[i] = string(r)
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,64 @@
+package places
+
+import "testing"
+
+// TestParse tests parsing upstream location strings into places
+func TestParse(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected Place
+		display  string
+	}{
+		{"los_angeles-usa", Place{City: "Los Angeles", Country: "USA", CountryCode: "US"}, "Los Angeles, USA"},
+		{"north_carolina-usa", Place{Region: "North Carolina", Country: "USA", CountryCode: "US"}, "North Carolina, USA"},
+		{"new_york-usa", Place{City: "New York", Country: "USA", CountryCode: "US"}, "New York, USA"},
+		{"playa_del_carmen-mexico", Place{City: "Playa del Carmen", Country: "Mexico", CountryCode: "MX"}, "Playa del Carmen, Mexico"},
+		{"victoria-australia", Place{Region: "Victoria", Country: "Australia", CountryCode: "AU"}, "Victoria, Australia"},
+		{"london-uk", Place{City: "London", Country: "UK", CountryCode: "GB"}, "London, UK"},
+		{" Papeete-French_Polynesia ", Place{City: "Papeete", Country: "French Polynesia", CountryCode: "PF"}, "Papeete, French Polynesia"},
+		{"springfield-atlantis", Place{City: "Springfield", Country: "Atlantis"}, "Springfield, Atlantis"},
+		{"springfield", Place{City: "Springfield"}, "Springfield"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got := Parse(tt.raw)
+			if got != tt.expected {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.raw, got, tt.expected)
+			}
+			if got.String() != tt.display {
+				t.Errorf("Parse(%q).String() = %q, want %q", tt.raw, got.String(), tt.display)
+			}
+		})
+	}
+}
+
+// TestMatches tests precise country and city matching
+func TestMatches(t *testing.T) {
+	la := Parse("los_angeles-usa")
+	nc := Parse("north_carolina-usa")
+
+	tests := []struct {
+		name     string
+		got      bool
+		expected bool
+	}{
+		{"country by name", la.MatchesCountry("usa"), true},
+		{"country by code", la.MatchesCountry("US"), true},
+		{"country partial", la.MatchesCountry("us a"), false},
+		{"multi-word country", Parse("dunedin-new_zealand").MatchesCountry("New Zealand"), true},
+		{"city by display name", la.MatchesCity("Los Angeles"), true},
+		{"city by slug", la.MatchesCity("los_angeles"), true},
+		{"city partial", la.MatchesCity("angeles"), false},
+		{"region as city", nc.MatchesCity("north carolina"), true},
+		{"empty", la.MatchesCity(""), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.expected {
+				t.Errorf("got %v, want %v", tt.got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,387 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokPhrase
+	tokLParen
+	tokRParen
+	tokAnd
+	tokOr
+	tokNot
+)
+
+// token is a lexical token. pos and end are rune offsets in the query.
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+	end  int
+}
+
+// Parse parses a query. An empty query parses to nil, which matches every
+// artist. Invalid queries return a *SyntaxError.
+func Parse(input string) (Node, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, nil
+	}
+
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, &SyntaxError{Pos: tok.pos, Msg: "unexpected )"}
+	}
+	return n, nil
+}
+
+// lex splits input into tokens. Words run up to whitespace, a parenthesis
+// or a quote, so `member:"Freddie"` lexes as the word `member:` directly
+// followed by a phrase.
+func lex(input string) ([]token, error) {
+	r := []rune(input)
+	var tokens []token
+	for i := 0; i < len(r); {
+		switch {
+		case unicode.IsSpace(r[i]):
+			i++
+		case r[i] == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: i, end: i + 1})
+			i++
+		case r[i] == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: i, end: i + 1})
+			i++
+		case r[i] == '"':
+			j := i + 1
+			for j < len(r) && r[j] != '"' {
+				j++
+			}
+			if j == len(r) {
+				return nil, &SyntaxError{Pos: i, Msg: "unterminated quoted phrase"}
+			}
+			tokens = append(tokens, token{kind: tokPhrase, text: string(r[i+1 : j]), pos: i, end: j + 1})
+			i = j + 1
+		case r[i] == '-' && i+1 < len(r) && !unicode.IsSpace(r[i+1]) && r[i+1] != ')':
+			tokens = append(tokens, token{kind: tokNot, text: "-", pos: i, end: i + 1})
+			i++
+		default:
+			j := i
+			for j < len(r) && !unicode.IsSpace(r[j]) && r[j] != '(' && r[j] != ')' && r[j] != '"' {
+				j++
+			}
+			tok := token{kind: tokWord, text: string(r[i:j]), pos: i, end: j}
+			switch tok.text {
+			case "AND":
+				tok.kind = tokAnd
+			case "OR":
+				tok.kind = tokOr
+			case "NOT":
+				tok.kind = tokNot
+			}
+			tokens = append(tokens, tok)
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	next   int
+}
+
+func (p *parser) peek() token {
+	if p.next < len(p.tokens) {
+		return p.tokens[p.next]
+	}
+	end := 0
+	if len(p.tokens) > 0 {
+		end = p.tokens[len(p.tokens)-1].end
+	}
+	return token{kind: tokEOF, pos: end, end: end}
+}
+
+func (p *parser) advance() token {
+	tok := p.peek()
+	if p.next < len(p.tokens) {
+		p.next++
+	}
+	return tok
+}
+
+// startsTerm reports whether tok can begin an operand.
+func startsTerm(tok token) bool {
+	switch tok.kind {
+	case tokWord, tokPhrase, tokLParen, tokNot:
+		return true
+	}
+	return false
+}
+
+// expectTerm fails unless the next token can begin an operand of op.
+func (p *parser) expectTerm(op token) error {
+	if tok := p.peek(); !startsTerm(tok) {
+		return &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("expected a term after %s", op.text)}
+	}
+	return nil
+}
+
+// parseOr parses and-expressions separated by OR.
+func (p *parser) parseOr() (Node, error) {
+	n, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []Node{n}
+	for p.peek().kind == tokOr {
+		if err := p.expectTerm(p.advance()); err != nil {
+			return nil, err
+		}
+		n, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return Or{Nodes: nodes}, nil
+}
+
+// parseAnd parses unary expressions joined by AND or juxtaposition.
+func (p *parser) parseAnd() (Node, error) {
+	n, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []Node{n}
+	for {
+		tok := p.peek()
+		if tok.kind == tokAnd {
+			if err := p.expectTerm(p.advance()); err != nil {
+				return nil, err
+			}
+		} else if !startsTerm(tok) {
+			break
+		}
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return And{Nodes: nodes}, nil
+}
+
+// parseUnary parses an operand, negated by any number of NOT or "-".
+func (p *parser) parseUnary() (Node, error) {
+	if p.peek().kind != tokNot {
+		return p.parsePrimary()
+	}
+	if err := p.expectTerm(p.advance()); err != nil {
+		return nil, err
+	}
+	n, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return Not{Node: n}, nil
+}
+
+// parsePrimary parses a parenthesised expression or a term.
+func (p *parser) parsePrimary() (Node, error) {
+	tok := p.advance()
+	switch tok.kind {
+	case tokLParen:
+		if next := p.peek(); !startsTerm(next) {
+			return nil, &SyntaxError{Pos: next.pos, Msg: "expected a term after ("}
+		}
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokRParen {
+			return nil, &SyntaxError{Pos: tok.pos, Msg: "missing closing )"}
+		}
+		p.advance()
+		return n, nil
+	case tokPhrase:
+		return Term{Field: FieldText, Text: tok.text, Pos: tok.pos}, nil
+	case tokWord:
+		if field, value, ok := splitField(tok.text); ok {
+			return p.parseField(tok, field, value)
+		}
+		return p.parseText(tok)
+	case tokEOF:
+		return nil, &SyntaxError{Pos: tok.pos, Msg: "expected a term"}
+	default:
+		return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("unexpected %s", tok.text)}
+	}
+}
+
+// parseText merges a bare word with the bare words following it into one
+// free-text term. A lone four-digit number is a creation year instead.
+func (p *parser) parseText(first token) (Node, error) {
+	words := []string{first.text}
+	for {
+		tok := p.peek()
+		if tok.kind != tokWord {
+			break
+		}
+		if _, _, ok := splitField(tok.text); ok {
+			break
+		}
+		words = append(words, p.advance().text)
+	}
+
+	if len(words) == 1 && isYear(first.text) {
+		year, _ := strconv.Atoi(first.text)
+		return Term{Field: FieldCreated, Min: year, Max: year, Pos: first.pos}, nil
+	}
+	return Term{Field: FieldText, Text: strings.Join(words, " "), Pos: first.pos}, nil
+}
+
+// parseField parses the value of a field term. The value follows the colon
+// in the same word, or is a phrase directly after it.
+func (p *parser) parseField(tok token, name, value string) (Node, error) {
+	field := Field(strings.ToLower(name))
+	if value == "" {
+		next := p.peek()
+		if next.kind != tokPhrase || next.pos != tok.end {
+			return nil, &SyntaxError{Pos: tok.end, Msg: fmt.Sprintf("missing value after %s:", name)}
+		}
+		value = p.advance().text
+	}
+
+	term := Term{Field: field, Pos: tok.pos}
+	if !field.Numeric() {
+		term.Text = value
+		return term, nil
+	}
+
+	min, max, err := parseYears(value)
+	if err != nil {
+		return nil, &SyntaxError{Pos: tok.pos + len([]rune(name)) + 1, Msg: fmt.Sprintf("%s: %v", field, err)}
+	}
+	term.Min, term.Max = min, max
+	return term, nil
+}
+
+// parseYears parses a year, a range such as 1970..1980, 1970.. or ..1980,
+// or a comparison such as <1990 or >=1970, into inclusive bounds.
+func parseYears(value string) (int, int, error) {
+	for _, op := range []string{"<=", ">=", "<", ">", "="} {
+		if !strings.HasPrefix(value, op) {
+			continue
+		}
+		year, err := parseYear(strings.TrimPrefix(value, op))
+		if err != nil {
+			return 0, 0, err
+		}
+		switch op {
+		case "<=":
+			return math.MinInt, year, nil
+		case ">=":
+			return year, math.MaxInt, nil
+		case "<":
+			return math.MinInt, year - 1, nil
+		case ">":
+			return year + 1, math.MaxInt, nil
+		default:
+			return year, year, nil
+		}
+	}
+
+	from, to, isRange := strings.Cut(value, "..")
+	if !isRange {
+		year, err := parseYear(value)
+		return year, year, err
+	}
+	if from == "" && to == "" {
+		return 0, 0, fmt.Errorf("range %q needs at least one bound", value)
+	}
+
+	min, max := math.MinInt, math.MaxInt
+	var err error
+	if from != "" {
+		if min, err = parseYear(from); err != nil {
+			return 0, 0, err
+		}
+	}
+	if to != "" {
+		if max, err = parseYear(to); err != nil {
+			return 0, 0, err
+		}
+	}
+	if min > max {
+		return 0, 0, fmt.Errorf("range %q is empty", value)
+	}
+	return min, max, nil
+}
+
+// maxYear bounds the years a query may name, so comparisons such as >year
+// cannot overflow.
+const maxYear = 9999
+
+func parseYear(s string) (int, error) {
+	year, err := strconv.Atoi(s)
+	if err != nil || year < 0 {
+		return 0, fmt.Errorf("%q is not a year, want e.g. 1970, 1970..1980 or <1990", s)
+	}
+	if year > maxYear {
+		return 0, fmt.Errorf("year %s is out of range, want 0 to %d", s, maxYear)
+	}
+	return year, nil
+}
+
+// splitField splits a word of the form field:value. The field must be one
+// of the known fields, in any case, so words such as ac:dc or times like
+// 12:30 stay plain words.
+func splitField(word string) (string, string, bool) {
+	name, value, ok := strings.Cut(word, ":")
+	if !ok || !knownField(Field(strings.ToLower(name))) {
+		return "", "", false
+	}
+	return name, value, true
+}
+
+func isYear(s string) bool {
+	if len(s) != 4 {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func knownField(f Field) bool {
+	for _, field := range fields {
+		if field == f {
+			return true
+		}
+	}
+	return false
+}
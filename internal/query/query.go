@@ -0,0 +1,128 @@
+// Package query parses the search syntax accepted by /api/search, such as
+// `member:"Freddie" location:usa created:1970..1980 album:<1990 -name:queen`,
+// into a syntax tree the search package evaluates.
+//
+// Terms are combined with AND (implied between terms), OR and NOT (or a
+// leading "-"), and grouped with parentheses. AND binds tighter than OR.
+// Consecutive bare words form one free-text term matched against every
+// field, and a bare four-digit number matches the creation year.
+package query
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Field is the part of an artist a term is restricted to.
+type Field string
+
+const (
+	FieldText     Field = "" // free text, matched against every field
+	FieldName     Field = "name"
+	FieldMember   Field = "member"
+	FieldLocation Field = "location"
+	FieldCountry  Field = "country"
+	FieldCity     Field = "city"
+	FieldCreated  Field = "created"
+	FieldAlbum    Field = "album"
+)
+
+// fields lists the fields accepted before a colon, in the order error
+// messages name them.
+var fields = []Field{FieldName, FieldMember, FieldLocation, FieldCreated, FieldAlbum, FieldCountry, FieldCity}
+
+// Numeric reports whether f compares years rather than text.
+func (f Field) Numeric() bool {
+	return f == FieldCreated || f == FieldAlbum
+}
+
+// Node is a node of a parsed query: an And, Or, Not or Term.
+type Node interface {
+	String() string
+}
+
+// And matches artists matching every node.
+type And struct {
+	Nodes []Node
+}
+
+// Or matches artists matching any node.
+type Or struct {
+	Nodes []Node
+}
+
+// Not matches artists not matching its node.
+type Not struct {
+	Node Node
+}
+
+// Term matches artists on a single field. Text fields match Text; numeric
+// fields match years from Min to Max inclusive, an open bound being
+// math.MinInt or math.MaxInt. Pos is the term's offset in the query, in
+// runes.
+type Term struct {
+	Field Field
+	Text  string
+	Min   int
+	Max   int
+	Pos   int
+}
+
+func (n And) String() string {
+	return join(n.Nodes, " AND ")
+}
+
+func (n Or) String() string {
+	return join(n.Nodes, " OR ")
+}
+
+func (n Not) String() string {
+	return "-" + n.Node.String()
+}
+
+func (t Term) String() string {
+	if !t.Field.Numeric() {
+		text := strconv.Quote(t.Text)
+		if t.Field == FieldText {
+			return text
+		}
+		return string(t.Field) + ":" + text
+	}
+
+	switch {
+	case t.Min == t.Max:
+		return fmt.Sprintf("%s:%d", t.Field, t.Min)
+	case t.Min == math.MinInt:
+		return fmt.Sprintf("%s:..%d", t.Field, t.Max)
+	case t.Max == math.MaxInt:
+		return fmt.Sprintf("%s:%d..", t.Field, t.Min)
+	default:
+		return fmt.Sprintf("%s:%d..%d", t.Field, t.Min, t.Max)
+	}
+}
+
+// Contains reports whether year falls within a numeric term's range.
+func (t Term) Contains(year int) bool {
+	return year >= t.Min && year <= t.Max
+}
+
+func join(nodes []Node, sep string) string {
+	parts := make([]string, len(nodes))
+	for i, n := range nodes {
+		parts[i] = n.String()
+	}
+	return "(" + strings.Join(parts, sep) + ")"
+}
+
+// SyntaxError reports invalid query syntax. Pos is the offset of the
+// offending input, in runes.
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("invalid query at column %d: %s", e.Pos+1, e.Msg)
+}
@@ -0,0 +1,116 @@
+package query
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestParse tests parsing queries into syntax trees
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"Free text", "queen", `"queen"`},
+		{"Bare words merge", "freddie  mercury", `"freddie mercury"`},
+		{"Bare year", "1970", "created:1970"},
+		{"Year among words", "queen 1970", `"queen 1970"`},
+		{"Quoted phrase", `"pink floyd"`, `"pink floyd"`},
+		{"Field", "name:queen", `name:"queen"`},
+		{"Field phrase", `member:"Freddie Mercury"`, `member:"Freddie Mercury"`},
+		{"Field case", "Country:USA", `country:"USA"`},
+		{"Range", "created:1970..1980", "created:1970..1980"},
+		{"Open range", "created:1970..", "created:1970.."},
+		{"Less than", "album:<1990", "album:..1989"},
+		{"At most", "album:<=1990", "album:..1990"},
+		{"Greater than", "album:>1990", "album:1991.."},
+		{"Equal", "created:=1965", "created:1965"},
+		{"Negation", "-name:queen", `-name:"queen"`},
+		{"NOT keyword", "NOT queen", `-"queen"`},
+		{"Lowercase keywords are words", "not queen", `"not queen"`},
+		{"Implicit AND", "freddie -name:queen", `("freddie" AND -name:"queen")`},
+		{"Explicit AND", "freddie AND mercury", `("freddie" AND "mercury")`},
+		{"OR", "queen OR pink floyd", `("queen" OR "pink floyd")`},
+		{"AND binds tighter", "a name:x OR c", `(("a" AND name:"x") OR "c")`},
+		{
+			"Full example",
+			`member:"Freddie" location:usa created:1970..1980 album:<1990 -name:queen`,
+			`(member:"Freddie" AND location:"usa" AND created:1970..1980 AND album:..1989 AND -name:"queen")`,
+		},
+		{"Grouping", "(queen OR soja) country:usa", `(("queen" OR "soja") AND country:"usa")`},
+		{"Hyphenated word", "los_angeles-usa", `"los_angeles-usa"`},
+		{"Lone hyphen", "-", `"-"`},
+		{"Time is not a field", "12:30", `"12:30"`},
+		{"Unknown prefix is text", "ac:dc", `"ac:dc"`},
+		{"Unknown field is text", "genre:rock live", `"genre:rock live"`},
+		{"Empty", "   ", "<nil>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.input, err)
+			}
+			got := "<nil>"
+			if n != nil {
+				got = n.String()
+			}
+			if got != tt.expected {
+				t.Errorf("Parse(%q) = %s, want %s", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestParseErrors tests the position and message of syntax errors
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		pos   int
+		msg   string
+	}{
+		{"Unterminated phrase", `name:"queen`, 5, "unterminated quoted phrase"},
+		{"Missing value", "name: queen", 5, "missing value after name:"},
+		{"Bad year", "created:soon", 8, `created: "soon" is not a year, want e.g. 1970, 1970..1980 or <1990`},
+		{"Year too large", "album:>9223372036854775807", 6, "album: year 9223372036854775807 is out of range, want 0 to 9999"},
+		{"Range end too large", "created:1970..10000", 8, "created: year 10000 is out of range, want 0 to 9999"},
+		{"Empty range", "album:1990..1980", 6, `album: range "1990..1980" is empty`},
+		{"Unbounded range", "album:..", 6, `album: range ".." needs at least one bound`},
+		{"Dangling OR", "queen OR", 8, "expected a term after OR"},
+		{"Leading AND", "AND queen", 0, "unexpected AND"},
+		{"Dangling NOT", "queen NOT", 9, "expected a term after NOT"},
+		{"Empty group", "()", 1, "expected a term after ("},
+		{"Unclosed group", "(queen OR soja", 0, "missing closing )"},
+		{"Unopened group", "queen)", 5, "unexpected )"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("Parse(%q) error = %v, want a SyntaxError", tt.input, err)
+			}
+			if syntaxErr.Pos != tt.pos || syntaxErr.Msg != tt.msg {
+				t.Errorf("Parse(%q) error = {%d %q}, want {%d %q}", tt.input, syntaxErr.Pos, syntaxErr.Msg, tt.pos, tt.msg)
+			}
+		})
+	}
+}
+
+// TestTermContains tests numeric term ranges
+func TestTermContains(t *testing.T) {
+	n, err := Parse("created:1970..1980")
+	if err != nil {
+		t.Fatal(err)
+	}
+	term := n.(Term)
+	for year, expected := range map[int]bool{1969: false, 1970: true, 1975: true, 1980: true, 1981: false} {
+		if got := term.Contains(year); got != expected {
+			t.Errorf("Contains(%d) = %v, want %v", year, got, expected)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// DefaultMaxEdits is the default typo tolerance: the most single-character
+// edits a query word may be away from an indexed word and still match it.
+const DefaultMaxEdits = 2
+
+// MaxEdits caps the typo tolerance that may be configured or requested;
+// beyond it short words match almost anything.
+const MaxEdits = 3
+
+// foldTable maps accented Latin letters to their unaccented form. Every
+// mapping is one rune to one rune, so folded strings keep their rune offsets.
+var foldTable = func() map[rune]rune {
+	groups := map[rune]string{
+		'a': "àáâãäåāăą",
+		'c': "çćĉċč",
+		'd': "ďđ",
+		'e': "èéêëēĕėęě",
+		'g': "ĝğġģ",
+		'h': "ĥħ",
+		'i': "ìíîïĩīĭįı",
+		'j': "ĵ",
+		'k': "ķ",
+		'l': "ĺļľŀł",
+		'n': "ñńņň",
+		'o': "òóôõöøōŏő",
+		'r': "ŕŗř",
+		's': "śŝşš",
+		't': "ţťŧ",
+		'u': "ùúûüũūŭůűų",
+		'w': "ŵ",
+		'y': "ýÿŷ",
+		'z': "źżž",
+	}
+	table := make(map[rune]rune)
+	for base, accented := range groups {
+		for _, r := range accented {
+			table[r] = base
+		}
+	}
+	return table
+}()
+
+// Fold lower-cases s and strips accents from Latin letters, so "Beyoncé"
+// and "beyonce" compare equal.
+func Fold(s string) string {
+	return strings.Map(func(r rune) rune {
+		r = unicode.ToLower(r)
+		if folded, ok := foldTable[r]; ok {
+			return folded
+		}
+		return r
+	}, s)
+}
+
+// allowedEdits scales the typo tolerance with word length: short words must
+// match exactly, since one edit already turns them into other words.
+func allowedEdits(word string, maxEdits int) int {
+	n := len([]rune(word))
+	switch {
+	case n <= 3:
+		return 0
+	case n <= 5:
+		return min(1, maxEdits)
+	default:
+		return maxEdits
+	}
+}
+
+// editDistance returns the Levenshtein distance between a and b, or max+1
+// once it is known to exceed max.
+func editDistance(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if abs(len(ra)-len(rb)) > max {
+		return max + 1
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		best := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			best = min(best, curr[j])
+		}
+		if best > max {
+			return max + 1
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// trigrams returns the distinct three-rune windows of a word padded with
+// spaces, so short words and word edges still produce trigrams.
+func trigrams(word string) []string {
+	r := []rune(" " + word + " ")
+	seen := make(map[string]bool)
+	var grams []string
+	for i := 0; i+3 <= len(r); i++ {
+		g := string(r[i : i+3])
+		if !seen[g] {
+			seen[g] = true
+			grams = append(grams, g)
+		}
+	}
+	return grams
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,520 @@
+// Package search holds the in-memory index the search and suggestion
+// endpoints query. An Index is built once per cache refresh and never
+// modified afterwards, so it can be shared freely between requests.
+package search
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"groupie-tracker/internal/models"
+	"groupie-tracker/internal/places"
+)
+
+// Field identifies which part of an artist an indexed value comes from. The
+// values double as the suggestion types shown to users.
+type Field string
+
+const (
+	FieldName       Field = "artist/band"
+	FieldMember     Field = "member"
+	FieldFirstAlbum Field = "first album"
+	FieldCreation   Field = "created date"
+	FieldLocation   Field = "location"
+)
+
+// Document is an artist together with the data the endpoints filter and
+// sort on. Concerts counts the artist's valid concert dates.
+type Document struct {
+	Artist    models.Artist
+	Locations []string
+	Places    []places.Place
+	Concerts  int
+}
+
+// entry is one indexed field value. Text is what users see; variants are
+// the folded spellings a query is matched against and tokens the words in
+// them.
+type entry struct {
+	doc      int
+	field    Field
+	text     string
+	variants []string
+	tokens   []string
+}
+
+// Hit is an artist matching a query, by its position in upstream order.
+// Score ranges from 0 to 1, 1 being an exact match of the whole name, and
+// Matches lists the field values that matched, best first.
+type Hit struct {
+	Doc     int
+	Score   float64
+	Matches []models.FieldMatch
+}
+
+// Scores given to exact matches, by where the query sits in the field: the
+// whole field, its start, the start of a later word or anywhere. Fuzzy
+// matches score at most scoreFuzzy, so they always rank below exact ones.
+const (
+	scoreWhole    = 1.0
+	scorePrefix   = 0.9
+	scoreWord     = 0.85
+	scoreContains = 0.8
+	scoreFuzzy    = 0.6
+)
+
+// fieldWeights scale match scores by the field matched, so a name match
+// outranks an incidental location match of the same quality.
+var fieldWeights = map[Field]float64{
+	FieldName:       1.0,
+	FieldMember:     0.8,
+	FieldFirstAlbum: 0.5,
+	FieldCreation:   0.5,
+	FieldLocation:   0.4,
+}
+
+// Index is an inverted index from tokens to the field values containing
+// them, plus a trigram index over the tokens for typo-tolerant lookups.
+// Entries are numbered in upstream artist order, and within an artist by
+// field, so equally scored results come back in a stable order.
+type Index struct {
+	docs     []Document
+	entries  []entry
+	postings map[string][]int
+	vocab    []string
+	grams    map[string][]int
+}
+
+// Build indexes every artist in data.
+func Build(data models.Datas) *Index {
+	locations := make(map[int][]string, len(data.LocationsData.Index))
+	for _, loc := range data.LocationsData.Index {
+		locations[loc.ID] = loc.Locations
+	}
+
+	idx := &Index{
+		docs:     make([]Document, 0, len(data.ArtistsData)),
+		postings: make(map[string][]int),
+	}
+
+	for _, artist := range data.ArtistsData {
+		doc := Document{Artist: artist, Concerts: len(data.ConcertDates[artist.ID])}
+		for _, loc := range locations[artist.ID] {
+			loc = strings.TrimSpace(loc)
+			doc.Locations = append(doc.Locations, loc)
+			doc.Places = append(doc.Places, places.Parse(loc))
+		}
+
+		i := len(idx.docs)
+		idx.docs = append(idx.docs, doc)
+
+		idx.add(i, FieldName, artist.Name)
+		for _, member := range artist.Members {
+			idx.add(i, FieldMember, member)
+		}
+		idx.add(i, FieldFirstAlbum, artist.FirstAlbum)
+		idx.add(i, FieldCreation, strconv.Itoa(artist.CreationDate))
+		for j, loc := range doc.Locations {
+			idx.add(i, FieldLocation, doc.Places[j].String(), loc)
+		}
+	}
+
+	idx.vocab = make([]string, 0, len(idx.postings))
+	for token := range idx.postings {
+		idx.vocab = append(idx.vocab, token)
+	}
+	sort.Strings(idx.vocab)
+
+	idx.grams = make(map[string][]int)
+	for i, token := range idx.vocab {
+		for _, g := range trigrams(token) {
+			idx.grams[g] = append(idx.grams[g], i)
+		}
+	}
+
+	return idx
+}
+
+// add indexes a field value shown as text and matched by text and any
+// alternative spellings.
+func (idx *Index) add(doc int, field Field, text string, alternatives ...string) {
+	e := entry{doc: doc, field: field, text: text}
+	for _, v := range append([]string{text}, alternatives...) {
+		e.variants = append(e.variants, Fold(v))
+	}
+
+	id := len(idx.entries)
+	seen := make(map[string]bool)
+	for _, v := range e.variants {
+		for _, token := range tokenize(v) {
+			if !seen[token] {
+				seen[token] = true
+				e.tokens = append(e.tokens, token)
+				idx.postings[token] = append(idx.postings[token], id)
+			}
+		}
+	}
+	idx.entries = append(idx.entries, e)
+}
+
+// Len returns the number of indexed artists.
+func (idx *Index) Len() int {
+	return len(idx.docs)
+}
+
+// Doc returns the i-th artist in upstream order.
+func (idx *Index) Doc(i int) Document {
+	return idx.docs[i]
+}
+
+// Match returns the artists with a name, member, first album date or
+// location matching query, best first, ties in upstream order. An artist
+// scores its best match weighted by the field matched. Matching ignores
+// case and accents; with maxEdits above zero, words may also be misspelt by
+// up to that many edits and appear in any order. An empty query matches
+// nothing.
+func (idx *Index) Match(query string, maxEdits int) []Hit {
+	return idx.match(query, maxEdits, FieldName, FieldMember, FieldFirstAlbum, FieldLocation)
+}
+
+// match is Match restricted to the given fields.
+func (idx *Index) match(query string, maxEdits int, fields ...Field) []Hit {
+	q := idx.prepare(query, maxEdits)
+	matches := idx.matchEntries(q, fields...)
+	for i := range matches {
+		matches[i].score *= fieldWeights[idx.entries[matches[i].id].field]
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+
+	// Matches are best first, so an artist's first match sets its score
+	var hits []Hit
+	byDoc := make(map[int]int)
+	for _, m := range matches {
+		e := idx.entries[m.id]
+		i, ok := byDoc[e.doc]
+		if !ok {
+			i = len(hits)
+			byDoc[e.doc] = i
+			hits = append(hits, Hit{Doc: e.doc, Score: m.score})
+		}
+		hits[i].Matches = append(hits[i].Matches, models.FieldMatch{
+			Field: string(e.field),
+			Value: e.text,
+			Spans: q.spans(e),
+		})
+	}
+
+	sortHits(hits)
+	return hits
+}
+
+// sortHits orders hits best first, ties in upstream order.
+func sortHits(hits []Hit) {
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Doc < hits[j].Doc
+	})
+}
+
+// Suggest returns up to limit distinct field values matching query, typed
+// by the field they come from, with the artists sharing each value. No more
+// than perType values of one type are returned; zero limits are unlimited.
+//
+// Matching follows Match. Values are ranked by where the query matches
+// them, regardless of field: the whole value, its start, the start of one
+// of its words, anywhere, then misspelt. Equal matches rank by popularity:
+// the number of artists sharing the value, then their concert count.
+func (idx *Index) Suggest(query string, maxEdits, limit, perType int) []models.Suggestion {
+	type candidate struct {
+		suggestion models.Suggestion
+		score      float64
+		concerts   int
+	}
+
+	// Entries come in index order, so candidates start out in upstream
+	// order and each one's artists are listed in upstream order
+	var candidates []*candidate
+	byKey := make(map[string]*candidate)
+	for _, m := range idx.matchEntries(idx.prepare(query, maxEdits)) {
+		e := idx.entries[m.id]
+		key := e.text + "|" + string(e.field)
+		c, ok := byKey[key]
+		if !ok {
+			c = &candidate{suggestion: models.Suggestion{Text: e.text, Type: string(e.field)}}
+			byKey[key] = c
+			candidates = append(candidates, c)
+		}
+		c.score = max(c.score, m.score)
+
+		doc := idx.docs[e.doc]
+		ids := c.suggestion.ArtistIDs
+		if len(ids) == 0 || ids[len(ids)-1] != doc.Artist.ID {
+			c.suggestion.ArtistIDs = append(ids, doc.Artist.ID)
+			c.concerts += doc.Concerts
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		switch {
+		case a.score != b.score:
+			return a.score > b.score
+		case len(a.suggestion.ArtistIDs) != len(b.suggestion.ArtistIDs):
+			return len(a.suggestion.ArtistIDs) > len(b.suggestion.ArtistIDs)
+		default:
+			return a.concerts > b.concerts
+		}
+	})
+
+	var suggestions []models.Suggestion
+	perTypeCount := make(map[string]int)
+	for _, c := range candidates {
+		if limit > 0 && len(suggestions) == limit {
+			break
+		}
+		if perType > 0 && perTypeCount[c.suggestion.Type] == perType {
+			continue
+		}
+		perTypeCount[c.suggestion.Type]++
+		suggestions = append(suggestions, c.suggestion)
+	}
+	return suggestions
+}
+
+type entryMatch struct {
+	id    int
+	score float64
+}
+
+// preparedQuery is a folded query together with the indexed tokens each of
+// its words matches.
+type preparedQuery struct {
+	text       string
+	expansions []map[string]float64
+	fuzzy      bool
+}
+
+func (idx *Index) prepare(query string, maxEdits int) preparedQuery {
+	q := preparedQuery{text: Fold(query), fuzzy: maxEdits > 0}
+	for _, qt := range tokenize(q.text) {
+		q.expansions = append(q.expansions, idx.expand(qt, maxEdits))
+	}
+	return q
+}
+
+// matchEntries returns, in index order, the entries of the given fields
+// (all fields when none are given) matching q, with their scores.
+func (idx *Index) matchEntries(q preparedQuery, fields ...Field) []entryMatch {
+	if strings.TrimSpace(q.text) == "" {
+		return nil
+	}
+
+	var matched []entryMatch
+	for _, id := range idx.candidates(q.expansions) {
+		e := idx.entries[id]
+		if len(fields) > 0 && !hasField(fields, e.field) {
+			continue
+		}
+		if score := exactScore(e, q.text); score > 0 {
+			matched = append(matched, entryMatch{id, score})
+		} else if q.fuzzy && len(q.expansions) > 0 {
+			matched = append(matched, entryMatch{id, fuzzyScore(e, q.expansions)})
+		}
+	}
+	return matched
+}
+
+// spans locates the parts of an entry's text matched by q: every occurrence
+// of the whole query or, when it only matched as separate or misspelt
+// words, or by an alternative spelling, the words matching a query word.
+func (q preparedQuery) spans(e entry) []models.Span {
+	text := []rune(e.variants[0])
+	query := []rune(q.text)
+
+	var spans []models.Span
+	for i := 0; len(query) > 0 && i+len(query) <= len(text); {
+		if string(text[i:i+len(query)]) == q.text {
+			spans = append(spans, models.Span{Start: i, End: i + len(query)})
+			i += len(query)
+		} else {
+			i++
+		}
+	}
+	if len(spans) > 0 {
+		return spans
+	}
+
+	for _, word := range wordSpans(text) {
+		token := string(text[word.Start:word.End])
+		for _, tokens := range q.expansions {
+			if tokens[token] > 0 {
+				spans = append(spans, word)
+				break
+			}
+		}
+	}
+	return spans
+}
+
+// expand returns the indexed tokens a query token matches, scored 1 when
+// they contain it and lower the more edits they are away from it.
+func (idx *Index) expand(qt string, maxEdits int) map[string]float64 {
+	matches := make(map[string]float64)
+	for _, token := range idx.vocab {
+		if strings.Contains(token, qt) {
+			matches[token] = 1
+		}
+	}
+
+	edits := allowedEdits(qt, maxEdits)
+	if edits == 0 {
+		return matches
+	}
+
+	length := float64(len([]rune(qt)))
+	checked := make(map[int]bool)
+	for _, g := range trigrams(qt) {
+		for _, i := range idx.grams[g] {
+			token := idx.vocab[i]
+			if checked[i] || matches[token] > 0 {
+				continue
+			}
+			checked[i] = true
+			if d := editDistance(qt, token, edits); d <= edits {
+				matches[token] = 1 - float64(d)/(length+1)
+			}
+		}
+	}
+	return matches
+}
+
+// candidates returns, in index order, the entries holding a match for every
+// query token. Without tokens every entry is a candidate.
+func (idx *Index) candidates(expansions []map[string]float64) []int {
+	if len(expansions) == 0 {
+		all := make([]int, len(idx.entries))
+		for i := range all {
+			all[i] = i
+		}
+		return all
+	}
+
+	var result []int
+	for i, tokens := range expansions {
+		set := make(map[int]bool)
+		for token := range tokens {
+			for _, id := range idx.postings[token] {
+				set[id] = true
+			}
+		}
+
+		if i == 0 {
+			for id := range set {
+				result = append(result, id)
+			}
+			continue
+		}
+		kept := result[:0]
+		for _, id := range result {
+			if set[id] {
+				kept = append(kept, id)
+			}
+		}
+		result = kept
+	}
+
+	sort.Ints(result)
+	return result
+}
+
+// exactScore scores an entry containing the whole query, or returns 0.
+func exactScore(e entry, query string) float64 {
+	score := 0.0
+	for _, v := range e.variants {
+		switch {
+		case v == query:
+			return scoreWhole
+		case strings.HasPrefix(v, query):
+			score = max(score, scorePrefix)
+		case startsWord(v, query):
+			score = max(score, scoreWord)
+		case strings.Contains(v, query):
+			score = max(score, scoreContains)
+		}
+	}
+	return score
+}
+
+// startsWord reports whether sub occurs in s at the start of a word.
+func startsWord(s, sub string) bool {
+	for i := 0; ; {
+		j := strings.Index(s[i:], sub)
+		if j < 0 {
+			return false
+		}
+		j += i
+		if r, _ := utf8.DecodeLastRuneInString(s[:j]); !isWordRune(r) {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(s[j:])
+		i = j + size
+	}
+}
+
+// fuzzyScore scores an entry by how closely its words match each query
+// token on average.
+func fuzzyScore(e entry, expansions []map[string]float64) float64 {
+	total := 0.0
+	for _, tokens := range expansions {
+		best := 0.0
+		for _, token := range e.tokens {
+			best = max(best, tokens[token])
+		}
+		total += best
+	}
+	return scoreFuzzy * total / float64(len(expansions))
+}
+
+// tokenize splits s into runs of letters and digits.
+func tokenize(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !isWordRune(r)
+	})
+}
+
+// wordSpans returns the rune offsets of the words tokenize finds in text.
+func wordSpans(text []rune) []models.Span {
+	var spans []models.Span
+	start := -1
+	for i, r := range text {
+		switch {
+		case isWordRune(r) && start < 0:
+			start = i
+		case !isWordRune(r) && start >= 0:
+			spans = append(spans, models.Span{Start: start, End: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, models.Span{Start: start, End: len(text)})
+	}
+	return spans
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func hasField(fields []Field, f Field) bool {
+	for _, field := range fields {
+		if field == f {
+			return true
+		}
+	}
+	return false
+}
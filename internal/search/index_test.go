@@ -0,0 +1,402 @@
+package search
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"groupie-tracker/internal/dates"
+	"groupie-tracker/internal/models"
+	"groupie-tracker/internal/query"
+)
+
+// loadFixtures reads the handler fixtures into a models.Datas, with dates
+// parsed as the cache does.
+func loadFixtures(t *testing.T) models.Datas {
+	t.Helper()
+	var data models.Datas
+	files := map[string]interface{}{
+		"artists.json":   &data.ArtistsData,
+		"locations.json": &data.LocationsData,
+		"dates.json":     &data.DatesData,
+		"relation.json":  &data.RelationsData,
+	}
+	for name, target := range files {
+		content, err := os.ReadFile(filepath.Join("..", "handlers", "testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(content, target); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dates.Annotate(&data)
+	return data
+}
+
+func names(idx *Index, hits []Hit) string {
+	var result []string
+	for _, hit := range hits {
+		result = append(result, idx.Doc(hit.Doc).Artist.Name)
+	}
+	return strings.Join(result, ",")
+}
+
+// TestMatch tests exact matching of artists by name, member, first album and
+// location
+func TestMatch(t *testing.T) {
+	idx := Build(loadFixtures(t))
+
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{"Name", "queen", "Queen"},
+		{"Name substring", "FLOY", "Pink Floyd"},
+		{"Member", "freddie", "Queen"},
+		{"Member phrase", "freddie mercury", "Queen"},
+		{"Phrase across word boundary", "ie merc", "Queen"},
+		{"Phrase must be contiguous", "mercury freddie", ""},
+		{"Member shared with name", "phil collins", "Phil Collins"},
+		{"First album", "1973", "Queen"},
+		{"Raw location", "los_angeles", "Queen,Phil Collins"},
+		{"Display location", "los angeles, usa", "Queen,Phil Collins"},
+		{"Separators only", "-", "Queen,SOJA,Pink Floyd,Phil Collins"},
+		{"Empty", "", ""},
+		{"No match", "zzz", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := names(idx, idx.Match(tt.query, 0)); got != tt.expected {
+				t.Errorf("Match(%q) = %q, want %q", tt.query, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestMatchFuzzy tests typo-tolerant and accent-insensitive matching
+func TestMatchFuzzy(t *testing.T) {
+	idx := Build(loadFixtures(t))
+
+	tests := []struct {
+		name     string
+		query    string
+		maxEdits int
+		expected string
+	}{
+		{"Exact match still ranks first", "queen", 2, "Queen"},
+		{"Extra letter", "queeen", 2, "Queen"},
+		{"Misspelt member", "freddy mercury", 2, "Queen"},
+		{"Words in any order", "mercury freddie", 2, "Queen"},
+		{"Substituted letter", "pink floid", 2, "Pink Floyd"},
+		{"Accented query", "Quéén", 0, "Queen"},
+		{"Short words must be exact", "sja", 2, ""},
+		{"Disabled", "queeen", 0, ""},
+		{"Too many edits", "qxxxxn", 2, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := names(idx, idx.Match(tt.query, tt.maxEdits)); got != tt.expected {
+				t.Errorf("Match(%q, %d) = %q, want %q", tt.query, tt.maxEdits, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestMatchScores tests that closer matches score higher
+func TestMatchScores(t *testing.T) {
+	idx := Build(loadFixtures(t))
+
+	score := func(query string) float64 {
+		hits := idx.Match(query, DefaultMaxEdits)
+		if len(hits) != 1 {
+			t.Fatalf("Match(%q) = %v, want one hit", query, hits)
+		}
+		return hits[0].Score
+	}
+
+	whole, prefix, contains := score("queen"), score("que"), score("ueen")
+	oneEdit, twoEdits := score("freddie mercuri"), score("freddy mercuri")
+	if !(whole > prefix && prefix > contains && contains > oneEdit && oneEdit > twoEdits && twoEdits > 0) {
+		t.Errorf("scores whole=%v prefix=%v contains=%v oneEdit=%v twoEdits=%v, want strictly decreasing",
+			whole, prefix, contains, oneEdit, twoEdits)
+	}
+	if whole != 1 {
+		t.Errorf("whole field score = %v, want 1", whole)
+	}
+}
+
+// TestMatchRanking tests that matches are weighted by the field matched
+func TestMatchRanking(t *testing.T) {
+	idx := Build(loadFixtures(t))
+
+	// Jacob Hemphill of SOJA matches as a member, Phil Collins by name
+	if got := names(idx, idx.Match("ph", 0)); got != "Phil Collins,SOJA" {
+		t.Errorf("Match(ph) = %q, want name match before member match", got)
+	}
+
+	hits := idx.Match("collins", 0)
+	if len(hits) != 1 || len(hits[0].Matches) != 2 {
+		t.Fatalf("Match(collins) = %+v, want one hit with two matches", hits)
+	}
+	if hits[0].Score != scoreWord {
+		t.Errorf("Match(collins) score = %v, want %v", hits[0].Score, scoreWord)
+	}
+	if hits[0].Matches[0].Field != string(FieldName) || hits[0].Matches[1].Field != string(FieldMember) {
+		t.Errorf("Match(collins) matches = %+v, want name before member", hits[0].Matches)
+	}
+}
+
+// TestMatchExplanations tests the matched fields and offsets reported per hit
+func TestMatchExplanations(t *testing.T) {
+	idx := Build(loadFixtures(t))
+
+	tests := []struct {
+		name     string
+		query    string
+		maxEdits int
+		expected models.FieldMatch
+	}{
+		{
+			name:     "Whole query",
+			query:    "mercury",
+			expected: models.FieldMatch{Field: "member", Value: "Freddie Mercury", Spans: []models.Span{{Start: 8, End: 15}}},
+		},
+		{
+			name:     "Misspelt words",
+			query:    "freddy mercury",
+			maxEdits: 2,
+			expected: models.FieldMatch{Field: "member", Value: "Freddie Mercury", Spans: []models.Span{{Start: 0, End: 7}, {Start: 8, End: 15}}},
+		},
+		{
+			name:     "Alternative spelling",
+			query:    "saitama-japan",
+			expected: models.FieldMatch{Field: "location", Value: "Saitama, Japan", Spans: []models.Span{{Start: 0, End: 7}, {Start: 9, End: 14}}},
+		},
+		{
+			name:     "Repeated",
+			query:    "r",
+			expected: models.FieldMatch{Field: "member", Value: "Roger Meddows-Taylor", Spans: []models.Span{{Start: 0, End: 1}, {Start: 4, End: 5}, {Start: 19, End: 20}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits := idx.Match(tt.query, tt.maxEdits)
+			if len(hits) == 0 || idx.Doc(hits[0].Doc).Artist.Name != "Queen" {
+				t.Fatalf("Match(%q) = %+v, want Queen first", tt.query, hits)
+			}
+			got := hits[0].Matches[0]
+			if got.Field != tt.expected.Field || got.Value != tt.expected.Value || !reflect.DeepEqual(got.Spans, tt.expected.Spans) {
+				t.Errorf("Match(%q) first match = %+v, want %+v", tt.query, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestQuery tests evaluating parsed queries
+func TestQuery(t *testing.T) {
+	idx := Build(loadFixtures(t))
+
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{"Empty", "", "Queen,SOJA,Pink Floyd,Phil Collins"},
+		{"Free text", "freddie mercury", "Queen"},
+		{"Bare year", "1970", "Queen"},
+		{"Creation range", "created:1960..1975", "Queen,Pink Floyd,Phil Collins"},
+		{"Album comparison", "album:<1970", "Pink Floyd"},
+		{"Name only", "name:phil", "Phil Collins"},
+		{"Member only, ranked", "member:phil", "Phil Collins,SOJA"},
+		{"Country", "country:usa", "Queen,Phil Collins"},
+		{"Negation", "country:usa -name:queen", "Phil Collins"},
+		{"Negation alone", "-country:usa", "SOJA,Pink Floyd"},
+		{"OR", "city:paris OR city:london", "Pink Floyd,Phil Collins"},
+		{"Grouping", "(queen OR soja) country:mexico", "SOJA"},
+		{"Location and album", "location:mexico album:>2000", "SOJA"},
+		{"Fuzzy", "queeen", "Queen"},
+		{"No match", "name:queen member:gilmour", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := query.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.query, err)
+			}
+			if got := names(idx, idx.Query(q, DefaultMaxEdits)); got != tt.expected {
+				t.Errorf("Query(%q) = %q, want %q", tt.query, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestQueryExplanations tests that a query reports the matches of each term
+func TestQueryExplanations(t *testing.T) {
+	idx := Build(loadFixtures(t))
+
+	q, err := query.Parse("member:freddie created:1970 OR created:1970")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits := idx.Query(q, 0)
+	if len(hits) != 1 {
+		t.Fatalf("Query() = %+v, want Queen only", hits)
+	}
+
+	expected := []models.FieldMatch{
+		{Field: "member", Value: "Freddie Mercury", Spans: []models.Span{{Start: 0, End: 7}}},
+		{Field: "created date", Value: "1970", Spans: []models.Span{{Start: 0, End: 4}}},
+	}
+	if !reflect.DeepEqual(hits[0].Matches, expected) {
+		t.Errorf("Query() matches = %+v, want %+v", hits[0].Matches, expected)
+	}
+	if want := (scorePrefix*fieldWeights[FieldMember] + fieldWeights[FieldCreation]) / 2; hits[0].Score != want {
+		t.Errorf("Query() score = %v, want %v", hits[0].Score, want)
+	}
+
+	q, _ = query.Parse("album:1973")
+	hits = idx.Query(q, 0)
+	if len(hits) != 1 || !reflect.DeepEqual(hits[0].Matches[0].Spans, []models.Span{{Start: 6, End: 10}}) {
+		t.Errorf("Query(album:1973) = %+v, want the year of 14-12-1973 highlighted", hits)
+	}
+}
+
+// TestFold tests case and accent folding
+func TestFold(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Beyoncé", "beyonce"},
+		{"MÖTLEY CRÜE", "motley crue"},
+		{"São Paulo", "sao paulo"},
+		{"plain", "plain"},
+	}
+
+	for _, tt := range tests {
+		if got := Fold(tt.input); got != tt.expected {
+			t.Errorf("Fold(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+// TestEditDistance tests the bounded Levenshtein distance
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		max      int
+		expected int
+	}{
+		{"queen", "queen", 2, 0},
+		{"queeen", "queen", 2, 1},
+		{"freddy", "freddie", 2, 2},
+		{"pnik", "pink", 2, 2},
+		{"kitten", "sitting", 2, 3},
+		{"a", "abcdef", 2, 3},
+	}
+
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b, tt.max); got != tt.expected {
+			t.Errorf("editDistance(%q, %q, %d) = %d, want %d", tt.a, tt.b, tt.max, got, tt.expected)
+		}
+	}
+}
+
+// TestSuggest tests typed, de-duplicated suggestions, best first
+func TestSuggest(t *testing.T) {
+	idx := Build(loadFixtures(t))
+
+	got := idx.Suggest("phil", 0, 0, 0)
+	expected := []models.Suggestion{
+		{Text: "Phil Collins", Type: "artist/band", ArtistIDs: []int{4}},
+		{Text: "Phil Collins", Type: "member", ArtistIDs: []int{4}},
+		{Text: "Jacob Hemphill", Type: "member", ArtistIDs: []int{2}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Suggest(phil) = %+v, want %+v", got, expected)
+	}
+
+	got = idx.Suggest("los", 0, 0, 0)
+	if len(got) != 1 || got[0].Text != "Los Angeles, USA" || got[0].Type != "location" {
+		t.Errorf("Suggest(los) = %+v, want one Los Angeles, USA location", got)
+	}
+
+	got = idx.Suggest("197", 0, 0, 0)
+	if len(got) != 3 {
+		t.Errorf("Suggest(197) = %+v, want 14-12-1973, 1970 and 1975", got)
+	}
+
+	got = idx.Suggest("colins", DefaultMaxEdits, 0, 0)
+	if len(got) == 0 || got[0].Text != "Phil Collins" {
+		t.Errorf("Suggest(colins) = %+v, want Phil Collins first", got)
+	}
+}
+
+// TestSuggestRanking tests ranking suggestions by match position and
+// popularity
+func TestSuggestRanking(t *testing.T) {
+	idx := Build(loadFixtures(t))
+
+	texts := func(suggestions []models.Suggestion) string {
+		var result []string
+		for _, s := range suggestions {
+			result = append(result, s.Text)
+		}
+		return strings.Join(result, ",")
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		// Los Angeles is shared by two artists, the others by one
+		{"Word before anywhere, then popularity", "usa", "Los Angeles, USA,North Carolina, USA,Georgia, USA,Lausanne, Switzerland"},
+		// Paris is played by the artist with fewer concerts
+		{"Prefix before word", "pa", "Patrick O'Shea,Papeete, French Polynesia,Paris, France,Saitama, Japan,Osaka, Japan,Nagoya, Japan"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := texts(idx.Suggest(tt.query, 0, 0, 0)); got != tt.expected {
+				t.Errorf("Suggest(%q) = %q, want %q", tt.query, got, tt.expected)
+			}
+		})
+	}
+
+	got := idx.Suggest("usa", 0, 0, 0)
+	if !reflect.DeepEqual(got[0].ArtistIDs, []int{1, 4}) {
+		t.Errorf("Suggest(usa)[0] artists = %v, want [1 4]", got[0].ArtistIDs)
+	}
+}
+
+// TestSuggestLimits tests capping suggestions overall and per type
+func TestSuggestLimits(t *testing.T) {
+	idx := Build(loadFixtures(t))
+
+	all := idx.Suggest("a", 0, 0, 0)
+	if len(all) < 10 {
+		t.Fatalf("Suggest(a) = %d suggestions, want at least 10 to cap", len(all))
+	}
+
+	if got := idx.Suggest("a", 0, 5, 0); !reflect.DeepEqual(got, all[:5]) {
+		t.Errorf("Suggest(a) limited to 5 = %+v, want the first 5 of %+v", got, all)
+	}
+
+	perType := make(map[string]int)
+	for _, s := range idx.Suggest("a", 0, 0, 2) {
+		perType[s.Type]++
+		if perType[s.Type] > 2 {
+			t.Errorf("Suggest(a) returned more than 2 %s suggestions", s.Type)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package search
+
+import (
+	"strconv"
+	"strings"
+
+	"groupie-tracker/internal/models"
+	"groupie-tracker/internal/places"
+	"groupie-tracker/internal/query"
+)
+
+// Query returns the artists matching a parsed query, best first, ties in
+// upstream order. Free-text terms match like Match, and name, member and
+// location terms like Match restricted to that field. Country and city
+// terms must name a place exactly, as the search filters do. A nil query
+// matches every artist, unscored.
+func (idx *Index) Query(q query.Node, maxEdits int) []Hit {
+	if q == nil {
+		hits := make([]Hit, len(idx.docs))
+		for i := range hits {
+			hits[i] = Hit{Doc: i}
+		}
+		return hits
+	}
+
+	result := idx.eval(q, maxEdits)
+	hits := make([]Hit, 0, len(result))
+	for _, hit := range result {
+		hit.Matches = distinctMatches(hit.Matches)
+		hits = append(hits, hit)
+	}
+	sortHits(hits)
+	return hits
+}
+
+// resultSet maps matching artists to their hits.
+type resultSet map[int]Hit
+
+func (idx *Index) eval(n query.Node, maxEdits int) resultSet {
+	switch n := n.(type) {
+	case query.And:
+		return idx.evalAnd(n, maxEdits)
+	case query.Or:
+		return idx.evalOr(n, maxEdits)
+	case query.Not:
+		excluded := idx.eval(n.Node, maxEdits)
+		result := make(resultSet)
+		for i := range idx.docs {
+			if _, ok := excluded[i]; !ok {
+				result[i] = Hit{Doc: i}
+			}
+		}
+		return result
+	case query.Term:
+		result := make(resultSet)
+		for _, hit := range idx.evalTerm(n, maxEdits) {
+			result[hit.Doc] = hit
+		}
+		return result
+	}
+	return resultSet{}
+}
+
+// evalAnd keeps the artists matching every node. Scores are averaged over
+// the nodes that are not negated, since those only exclude artists.
+func (idx *Index) evalAnd(n query.And, maxEdits int) resultSet {
+	var result resultSet
+	positive := 0
+	for i, child := range n.Nodes {
+		set := idx.eval(child, maxEdits)
+		if _, negated := child.(query.Not); !negated {
+			positive++
+		}
+		if i == 0 {
+			result = set
+			continue
+		}
+		for doc, hit := range result {
+			other, ok := set[doc]
+			if !ok {
+				delete(result, doc)
+				continue
+			}
+			hit.Score += other.Score
+			hit.Matches = append(hit.Matches, other.Matches...)
+			result[doc] = hit
+		}
+	}
+
+	if positive > 1 {
+		for doc, hit := range result {
+			hit.Score /= float64(positive)
+			result[doc] = hit
+		}
+	}
+	return result
+}
+
+// evalOr keeps the artists matching any node, scored by their best match.
+func (idx *Index) evalOr(n query.Or, maxEdits int) resultSet {
+	result := make(resultSet)
+	for _, child := range n.Nodes {
+		for doc, hit := range idx.eval(child, maxEdits) {
+			if prev, ok := result[doc]; ok {
+				hit.Score = max(hit.Score, prev.Score)
+				hit.Matches = append(prev.Matches, hit.Matches...)
+			}
+			result[doc] = hit
+		}
+	}
+	return result
+}
+
+func (idx *Index) evalTerm(t query.Term, maxEdits int) []Hit {
+	switch t.Field {
+	case query.FieldName:
+		return idx.match(t.Text, maxEdits, FieldName)
+	case query.FieldMember:
+		return idx.match(t.Text, maxEdits, FieldMember)
+	case query.FieldLocation:
+		return idx.match(t.Text, maxEdits, FieldLocation)
+	case query.FieldCountry:
+		return idx.matchPlaces(t.Text, places.Place.MatchesCountry)
+	case query.FieldCity:
+		return idx.matchPlaces(t.Text, places.Place.MatchesCity)
+	case query.FieldCreated, query.FieldAlbum:
+		return idx.matchYears(t)
+	default:
+		return idx.Match(t.Text, maxEdits)
+	}
+}
+
+// matchPlaces returns the artists with a place matching name, in upstream
+// order.
+func (idx *Index) matchPlaces(name string, matches func(places.Place, string) bool) []Hit {
+	var hits []Hit
+	for i, doc := range idx.docs {
+		var found []models.FieldMatch
+		for _, place := range doc.Places {
+			if matches(place, name) {
+				found = append(found, models.FieldMatch{Field: string(FieldLocation), Value: place.String()})
+			}
+		}
+		if len(found) > 0 {
+			hits = append(hits, Hit{Doc: i, Score: fieldWeights[FieldLocation], Matches: found})
+		}
+	}
+	return hits
+}
+
+// matchYears returns the artists whose creation or first album year falls
+// within a numeric term's range, in upstream order. Artists whose first
+// album date could not be parsed never match an album term.
+func (idx *Index) matchYears(t query.Term) []Hit {
+	var hits []Hit
+	for i, doc := range idx.docs {
+		artist := doc.Artist
+		field, year, value := FieldCreation, artist.CreationDate, strconv.Itoa(artist.CreationDate)
+		if t.Field == query.FieldAlbum {
+			if artist.FirstAlbumDate.IsZero() {
+				continue
+			}
+			field, year, value = FieldFirstAlbum, artist.FirstAlbumDate.Year(), artist.FirstAlbum
+		}
+		if !t.Contains(year) {
+			continue
+		}
+
+		match := models.FieldMatch{Field: string(field), Value: value}
+		if text := strconv.Itoa(year); strings.HasSuffix(value, text) {
+			end := len([]rune(value))
+			match.Spans = []models.Span{{Start: end - len(text), End: end}}
+		}
+		hits = append(hits, Hit{Doc: i, Score: fieldWeights[field], Matches: []models.FieldMatch{match}})
+	}
+	return hits
+}
+
+// distinctMatches drops matches repeated by several terms of a query.
+func distinctMatches(matches []models.FieldMatch) []models.FieldMatch {
+	seen := make(map[string]bool)
+	distinct := matches[:0]
+	for _, m := range matches {
+		key := m.Field + "|" + m.Value
+		if !seen[key] {
+			seen[key] = true
+			distinct = append(distinct, m)
+		}
+	}
+	return distinct
+}
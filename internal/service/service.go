@@ -1,16 +1,20 @@
 package service
 
 const (
+    BaseAPI      = "https://groupietrackers.herokuapp.com/api"
     ArtistsAPI   = "https://groupietrackers.herokuapp.com/api/artists"
     LocationsAPI = "https://groupietrackers.herokuapp.com/api/locations"
     DatesAPI     = "https://groupietrackers.herokuapp.com/api/dates"
     RelationsAPI = "https://groupietrackers.herokuapp.com/api/relation"
 )
 
-const (
-    MapboxAccessToken  = "pk.eyJ1Ijoic3RlbGxhYWNoYXJvaXJvIiwiYSI6ImNtMWhmZHNlODBlc3cybHF5OWh1MDI2dzMifQ.wk3v-v7IuiSiPwyq13qdHw"
-    MapboxGeocodingAPI = "https://api.mapbox.com/geocoding/v5/mapbox.places"
-)
+// MapboxGeocodingAPI is the default Mapbox forward geocoding endpoint. The
+// access token is a secret and comes from the configuration instead.
+const MapboxGeocodingAPI = "https://api.mapbox.com/geocoding/v5/mapbox.places"
+
+func GetBaseAPI() string {
+    return BaseAPI
+}
 
 func GetArtistsAPI() string {
     return ArtistsAPI
@@ -28,10 +32,6 @@ func GetRelationsAPI() string {
     return RelationsAPI
 }
 
-func GetMapboxAccessToken() string {
-    return MapboxAccessToken
-}
-
 func GetMapboxGeocodingAPI() string {
     return MapboxGeocodingAPI
 }
@@ -30,16 +30,15 @@ func TestGetRelationsAPI(t *testing.T) {
 	}
 }
 
-func TestGetMapboxAccessToken(t *testing.T) {
-	expected := "pk.eyJ1Ijoic3RlbGxhYWNoYXJvaXJvIiwiYSI6ImNtMWhmZHNlODBlc3cybHF5OWh1MDI2dzMifQ.wk3v-v7IuiSiPwyq13qdHw"
-	if got := GetMapboxAccessToken(); got != expected {
-		t.Errorf("GetMapboxAccessToken() = %v, want %v", got, expected)
-	}
-}
-
 func TestGetMapboxGeocodingAPI(t *testing.T) {
 	expected := "https://api.mapbox.com/geocoding/v5/mapbox.places"
 	if got := GetMapboxGeocodingAPI(); got != expected {
 		t.Errorf("GetMapboxGeocodingAPI() = %v, want %v", got, expected)
 	}
-}
\ No newline at end of file
+}
+func TestGetBaseAPI(t *testing.T) {
+	expected := "https://groupietrackers.herokuapp.com/api"
+	if got := GetBaseAPI(); got != expected {
+		t.Errorf("GetBaseAPI() = %v, want %v", got, expected)
+	}
+}
@@ -0,0 +1,40 @@
+// Package timeline builds an artist's concert timeline from the relation
+// data parsed when the cache is loaded.
+package timeline
+
+import (
+	"sort"
+	"time"
+
+	"groupie-tracker/internal/models"
+	"groupie-tracker/internal/places"
+)
+
+// Build turns a map of location to parsed concert dates, as kept in
+// Datas.RelationDates, into events sorted chronologically, ties broken by
+// location. Events on or after the day of now are marked upcoming.
+func Build(concerts map[string][]time.Time, now time.Time) []models.Event {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	events := make([]models.Event, 0, len(concerts))
+	for location, dates := range concerts {
+		place := places.Parse(location).String()
+		for _, date := range dates {
+			events = append(events, models.Event{
+				Location: location,
+				Place:    place,
+				Date:     date,
+				Upcoming: !date.Before(today),
+			})
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].Date.Equal(events[j].Date) {
+			return events[i].Date.Before(events[j].Date)
+		}
+		return events[i].Location < events[j].Location
+	})
+
+	return events
+}
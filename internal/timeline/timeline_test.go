@@ -0,0 +1,52 @@
+package timeline
+
+import (
+	"testing"
+	"time"
+
+	"groupie-tracker/internal/dates"
+	"groupie-tracker/internal/models"
+)
+
+// TestBuild tests building a sorted, classified timeline from parsed
+// relation dates, without the ones that failed to parse
+func TestBuild(t *testing.T) {
+	relations := map[string][]string{
+		"playa_del_carmen-mexico":  {"07-12-2019", "05-12-2019", "06-12-2019"},
+		"papeete-french_polynesia": {"16-11-2019"},
+		"noumea-new_caledonia":     {"15-11-2019", "not-a-date"},
+	}
+	var data models.Datas
+	data.RelationsData.Index = append(data.RelationsData.Index, struct {
+		ID             int                 `json:"id"`
+		DatesLocations map[string][]string `json:"datesLocations"`
+	}{ID: 1, DatesLocations: relations})
+	dates.Annotate(&data)
+	now := time.Date(2019, 12, 6, 18, 30, 0, 0, time.UTC)
+
+	events := Build(data.RelationDates[1], now)
+
+	expected := []struct {
+		location string
+		place    string
+		date     string
+		upcoming bool
+	}{
+		{"noumea-new_caledonia", "Noumea, New Caledonia", "15-11-2019", false},
+		{"papeete-french_polynesia", "Papeete, French Polynesia", "16-11-2019", false},
+		{"playa_del_carmen-mexico", "Playa del Carmen, Mexico", "05-12-2019", false},
+		{"playa_del_carmen-mexico", "Playa del Carmen, Mexico", "06-12-2019", true},
+		{"playa_del_carmen-mexico", "Playa del Carmen, Mexico", "07-12-2019", true},
+	}
+
+	if len(events) != len(expected) {
+		t.Fatalf("Build() returned %d events, want %d", len(events), len(expected))
+	}
+	for i, want := range expected {
+		got := events[i]
+		if got.Location != want.location || got.Place != want.place ||
+			got.Date.Format(dates.Layout) != want.date || got.Upcoming != want.upcoming {
+			t.Errorf("events[%d] = %+v, want %+v", i, got, want)
+		}
+	}
+}
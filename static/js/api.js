@@ -0,0 +1,28 @@
+// Helpers for calling the tracker's JSON API, shared by every page. Failed
+// requests carry the server's error message and request ID, so users can
+// quote them when reporting a problem.
+
+// readJSON returns the body of a successful API response, or throws an
+// Error carrying the server's message for a failed one
+function readJSON(response) {
+    if (response.ok) {
+        return response.json();
+    }
+    return response.json()
+        .catch(() => ({}))
+        .then(body => {
+            const error = new Error(body.message || `Request failed with status ${response.status}`);
+            error.fromServer = true;
+            error.requestId = body.requestId;
+            throw error;
+        });
+}
+
+// errorMessage describes a failed request: the server's own message when it
+// sent one, otherwise the fallback
+function errorMessage(error, fallback) {
+    if (!error.fromServer) {
+        return fallback;
+    }
+    return error.requestId ? `${error.message} (request ${error.requestId})` : error.message;
+}
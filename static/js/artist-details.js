@@ -2,7 +2,9 @@
 let map;
 let favorites = JSON.parse(localStorage.getItem('favorites')) || [];
 
-mapboxgl.accessToken = 'pk.eyJ1Ijoic3RlbGxhYWNoYXJvaXJvIiwiYSI6ImNtMWhmZHNlODBlc3cybHF5OWh1MDI2dzMifQ.wk3v-v7IuiSiPwyq13qdHw';
+// The server renders its configured Mapbox token into the page, so
+// rotating it needs no change here
+mapboxgl.accessToken = document.querySelector('meta[name="mapbox-token"]').content;
 
 function showLoading() {
     document.getElementById('loading').style.display = 'block';
@@ -63,6 +65,10 @@ function displayMap(locations) {
     if (map) {
         map.remove();
     }
+    if (!mapboxgl.accessToken) {
+        document.getElementById('map').textContent = 'The map is unavailable: no Mapbox token is configured.';
+        return;
+    }
 
     map = new mapboxgl.Map({
         container: 'map',
@@ -89,7 +95,7 @@ function displayMap(locations) {
             const popup = document.createElement('div');
             popup.className = 'custom-popup';
             popup.innerHTML = `
-                <h3 style="color: black; margin: 0; padding: 5px 0;">${location.address}</h3>
+                <h3 style="color: black; margin: 0; padding: 5px 0;">${location.name || location.address}</h3>
                 <button class="popup-close">&times;</button>
             `;
             popup.style.position = 'absolute';
@@ -131,6 +137,25 @@ function displayMap(locations) {
     }
 }
 
+function formatEventDate(date) {
+    return new Date(date).toLocaleDateString(undefined, { year: 'numeric', month: 'short', day: 'numeric', timeZone: 'UTC' });
+}
+
+function renderTimeline(events) {
+    const upcoming = events.filter(event => event.upcoming);
+    const past = events.filter(event => !event.upcoming);
+    const renderList = list => list.length
+        ? `<ul class="timeline-list">${list.map(event => `<li>${formatEventDate(event.date)} &mdash; ${event.place || event.location}</li>`).join('')}</ul>`
+        : '<p>None</p>';
+
+    return `
+        <h4>Upcoming</h4>
+        ${renderList(upcoming)}
+        <h4>Past</h4>
+        ${renderList(past)}
+    `;
+}
+
 function displayArtistDetails(details) {
     const container = document.getElementById('artist-details');
     
@@ -144,7 +169,7 @@ function displayArtistDetails(details) {
             
             <h3><i class="fas fa-map-marker-alt"></i> Locations:</h3>
             <ul class="locations-list">
-                ${details.locations.map(loc => `<li>${loc.address}</li>`).join('')}
+                ${details.locations.map(loc => `<li>${loc.name || loc.address}</li>`).join('')}
             </ul>
             
             <h3><i class="fas fa-calendar-check"></i> Dates:</h3>
@@ -152,6 +177,9 @@ function displayArtistDetails(details) {
                 ${details.dates.map(date => `<li>${date}</li>`).join('')}
             </ul>
             
+            <h3><i class="fas fa-stream"></i> Concert Timeline:</h3>
+            ${renderTimeline(details.events || [])}
+
             <h3><i class="fas fa-link"></i> Relations:</h3>
             <ul class="relations-list">
                 ${Object.entries(details.relations).map(([loc, dates]) => `
@@ -179,19 +207,14 @@ window.addEventListener('load', () => {
     if (artistId) {
         showLoading();
         fetch(`/api/artist/${artistId}`)
-            .then(response => {
-                if (!response.ok) {
-                    throw new Error('Network response was not ok');
-                }
-                return response.json();
-            })
+            .then(readJSON)
             .then(data => {
                 displayArtistDetails(data);
                 hideLoading();
             })
             .catch(error => {
                 console.error('Error:', error);
-                showError('An error occurred while fetching artist details. Please try again later.');
+                showError(errorMessage(error, 'An error occurred while fetching artist details. Please try again later.'));
                 hideLoading();
             });
     }
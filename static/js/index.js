@@ -6,7 +6,9 @@ function hideLoading() {
     document.getElementById('loading').style.display = 'none';
 }
 
-mapboxgl.accessToken = 'pk.eyJ1Ijoic3RlbGxhYWNoYXJvaXJvIiwiYSI6ImNtMWhmZHNlODBlc3cybHF5OWh1MDI2dzMifQ.wk3v-v7IuiSiPwyq13qdHw';
+// The server renders its configured Mapbox token into the page, so
+// rotating it needs no change here
+mapboxgl.accessToken = document.querySelector('meta[name="mapbox-token"]').content;
 
 const searchInput = document.getElementById('search-input');
 const suggestionsContainer = document.getElementById('suggestions');
@@ -16,6 +18,8 @@ const firstAlbumYearSlider = document.getElementById('first-album-year');
 const firstAlbumYearDisplay = document.getElementById('first-album-year-display');
 const memberCheckboxes = document.getElementById('member-checkboxes');
 const locationCheckboxes = document.getElementById('location-checkboxes');
+const countryCheckboxes = document.getElementById('country-checkboxes');
+const cityCheckboxes = document.getElementById('city-checkboxes');
 let allArtists = [];
 let allLocations = new Set();
 
@@ -24,8 +28,8 @@ searchInput.addEventListener('input', () => {
     const query = searchInput.value;
     if (query.length >= 1) {
         fetch(`/api/suggestions?q=${encodeURIComponent(query)}`)
-            .then(response => response.json())
-            .then(suggestions => displaySuggestions(suggestions))
+            .then(readJSON)
+            .then(suggestions => displaySuggestions(suggestions || []))
             .catch(error => console.error('Error:', error));
     } else {
         suggestionsContainer.innerHTML = '';
@@ -53,6 +57,12 @@ function displaySuggestions(suggestions) {
         div.className = 'suggestion-item';
         div.textContent = `${suggestion.text} (${suggestion.type})`;
         div.onclick = () => {
+            // Bands and members lead straight to their band's page
+            const ids = suggestion.artistIds || [];
+            if ((suggestion.type === 'artist/band' || suggestion.type === 'member') && ids.length === 1) {
+                window.location.href = `/artist/${ids[0]}`;
+                return;
+            }
             searchInput.value = suggestion.text;
             suggestionsContainer.innerHTML = '';
             searchArtists(suggestion.text);
@@ -61,24 +71,24 @@ function displaySuggestions(suggestions) {
     });
 }
 
+function applyFilters() {
+    searchArtists(searchInput.value);
+}
+
 function searchArtists(query = '') {
     showLoading();
-    const filters = getFilterValues();
-    fetch(`/api/search?q=${encodeURIComponent(query)}`, {
-        method: 'POST',
-        headers: {
-            'Content-Type': 'application/json',
-        },
-        body: JSON.stringify(filters)
-    })
-    .then(response => {
-        if (!response.ok) {
-            throw new Error('Network response was not ok');
-        }
-        return response.json();
-    })
+    const params = getFilterValues();
+    if (query) {
+        params.set('q', query);
+    }
+    // Keep the page URL in step so searches can be bookmarked and shared
+    history.replaceState(null, '', params.toString() ? `?${params}` : window.location.pathname);
+    params.set('facets', 'true');
+    fetch(`/api/search?${params}`)
+    .then(readJSON)
     .then(data => {
-        displayResults(data.artists);
+        displayResults(data.artists || [], data.hits);
+        displayFacets(data.facets);
         if (!allArtists.length) {
             allArtists = data.artists;
         }
@@ -86,33 +96,122 @@ function searchArtists(query = '') {
     })
     .catch(error => {
         console.error('Error:', error);
-        showError('An error occurred while searching for artists. Please try again later.');
+        showError(errorMessage(error, 'An error occurred while searching for artists. Please try again later.'));
         hideLoading();
     });
 }
 
+// getFilterValues returns the filters as search API query parameters. A
+// slider left at its minimum sets no bound, and omitted bounds are open.
 function getFilterValues() {
-    return {
-        creationYearMin: parseInt(document.getElementById('creation-year').value),
-        creationYearMax: 2023,
-        firstAlbumYearMin: parseInt(document.getElementById('first-album-year').value),
-        firstAlbumYearMax: 2023,
-        members: Array.from(document.querySelectorAll('#member-checkboxes input:checked')).map(cb => parseInt(cb.value)),
-        locations: Array.from(document.querySelectorAll('#location-checkboxes input:checked')).map(cb => cb.value)
-    };
+    const params = new URLSearchParams();
+    if (creationYearSlider.value !== creationYearSlider.min) {
+        params.set('creationYearMin', creationYearSlider.value);
+    }
+    if (firstAlbumYearSlider.value !== firstAlbumYearSlider.min) {
+        params.set('firstAlbumYearMin', firstAlbumYearSlider.value);
+    }
+    document.querySelectorAll('#member-checkboxes input:checked').forEach(cb => params.append('members', cb.value));
+    document.querySelectorAll('#location-checkboxes input:checked').forEach(cb => params.append('locations', cb.value));
+    document.querySelectorAll('#country-checkboxes input:checked').forEach(cb => params.append('countries', cb.value));
+    document.querySelectorAll('#city-checkboxes input:checked').forEach(cb => params.append('cities', cb.value));
+    return params;
+}
+
+// displayFacets rebuilds the filter checkboxes from the facet counts of the
+// current results, e.g. "USA (34)". Checked options stay listed even when
+// no result has them any more, so they can be unchecked.
+function displayFacets(facets) {
+    if (!facets) {
+        return;
+    }
+    renderFacet(memberCheckboxes, facets.members, value => `${value} member${value === '1' ? '' : 's'}`);
+    renderFacet(countryCheckboxes, facets.countries);
+    renderFacet(cityCheckboxes, facets.cities);
+}
+
+function renderFacet(container, counts, label = value => value) {
+    const checked = new Set(Array.from(container.querySelectorAll('input:checked')).map(cb => cb.value));
+    const options = counts.slice();
+    checked.forEach(value => {
+        if (!options.some(option => option.value === value)) {
+            options.push({ value, count: 0 });
+        }
+    });
+
+    container.innerHTML = '';
+    options.forEach(option => {
+        const item = document.createElement('label');
+        const checkbox = document.createElement('input');
+        checkbox.type = 'checkbox';
+        checkbox.value = option.value;
+        checkbox.checked = checked.has(option.value);
+        checkbox.addEventListener('change', applyFilters);
+        item.appendChild(checkbox);
+        item.appendChild(document.createTextNode(`${label(option.value)} (${option.count})`));
+        container.appendChild(item);
+    });
+}
+
+// restoreSearch fills the search box and sliders from a bookmarked URL
+function restoreSearch() {
+    const params = new URLSearchParams(window.location.search);
+    searchInput.value = params.get('q') || '';
+    if (params.has('creationYearMin')) {
+        creationYearSlider.value = params.get('creationYearMin');
+        creationYearDisplay.textContent = creationYearSlider.value;
+    }
+    if (params.has('firstAlbumYearMin')) {
+        firstAlbumYearSlider.value = params.get('firstAlbumYearMin');
+        firstAlbumYearDisplay.textContent = firstAlbumYearSlider.value;
+    }
+    // Check the bookmarked options; their counts arrive with the results
+    [[memberCheckboxes, 'members'], [countryCheckboxes, 'countries'], [cityCheckboxes, 'cities']].forEach(([container, name]) => {
+        params.getAll(name).forEach(value => {
+            container.insertAdjacentHTML('beforeend', '<label><input type="checkbox" checked></label>');
+            container.lastElementChild.firstChild.value = value;
+        });
+    });
+    return searchInput.value;
+}
+
+function escapeHTML(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML;
 }
 
-function displayResults(artists) {
+// highlight wraps the matched spans of value, given as code point offsets,
+// in <mark> elements
+function highlight(value, spans = []) {
+    const chars = Array.from(value);
+    let html = '';
+    let pos = 0;
+    spans.forEach(span => {
+        html += escapeHTML(chars.slice(pos, span.start).join(''));
+        html += `<mark>${escapeHTML(chars.slice(span.start, span.end).join(''))}</mark>`;
+        pos = span.end;
+    });
+    return html + escapeHTML(chars.slice(pos).join(''));
+}
+
+function displayResults(artists, hits = []) {
     const container = document.getElementById('results-container');
     container.innerHTML = '';
-    artists.forEach(artist => {
+    artists.forEach((artist, i) => {
+        const matches = (hits[i] && hits[i].matches) || [];
+        const nameMatch = matches.find(match => match.field === 'artist/band');
+        const otherMatch = matches.find(match => match.field !== 'artist/band');
+        const name = nameMatch ? highlight(nameMatch.value, nameMatch.spans) : escapeHTML(artist.name);
+
         const card = document.createElement('div');
         card.className = 'artist-card';
         card.innerHTML = `
-            <img src="placeholder.jpg" data-src="${artist.image}" alt="${artist.name}" class="lazy-image">
-            <h3>${artist.name}</h3>
+            <img src="placeholder.jpg" data-src="${artist.image}" alt="${escapeHTML(artist.name)}" class="lazy-image">
+            <h3>${name}</h3>
             <p><i class="fas fa-calendar-alt"></i> Created: ${artist.creationDate}</p>
             <p><i class="fas fa-compact-disc"></i> First Album: ${artist.firstAlbum}</p>
+            ${!nameMatch && otherMatch ? `<p class="match-reason">Matched ${escapeHTML(otherMatch.field)}: ${highlight(otherMatch.value, otherMatch.spans)}</p>` : ''}
         `;
         card.onclick = () => {
             window.location.href = `/artist/${artist.id}`;
@@ -155,5 +254,5 @@ function showError(message) {
 
 // Initialize the page
 window.addEventListener('load', () => {
-    searchArtists('');
+    searchArtists(restoreSearch());
 });
\ No newline at end of file